@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// tempFileSuffix завершает имена всех временных файлов; по нему RecoverDataDir
+// находит то, что осталось от прерванных записей.
+const tempFileSuffix = ".tmp"
+
+// writeFileAtomic заменяет path так, что после сбоя на диске остаётся либо прежний файл,
+// либо новый целиком. write заполняет временный файл с уникальным именем в tempDir; он
+// сбрасывается на диск и только затем переименовывается в path, после чего сбрасывается
+// и директория. tempDir должна лежать на той же файловой системе, что и path.
+func writeFileAtomic(path, tempDir string, write func(io.Writer) error) error {
+	file, err := os.CreateTemp(tempDir, filepath.Base(path)+".*"+tempFileSuffix)
+	if err != nil {
+		return err
+	}
+	tempPath := file.Name()
+
+	err = file.Chmod(0o644)
+	if err == nil {
+		err = write(file)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir сбрасывает на диск саму директорию, чтобы переименование в ней пережило сбой питания.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signV4Algorithm      = "AWS4-HMAC-SHA256"
+	signV4ChunkAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+	unsignedPayload      = "UNSIGNED-PAYLOAD"
+	streamingPayload     = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingUnsigned    = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	amzDateFormat        = "20060102T150405Z"
+	maxClockSkew         = 15 * time.Minute
+	maxPresignExpires    = 7 * 24 * 60 * 60
+	maxChunkSize         = 16 << 20
+	emptySHA256          = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var (
+	ErrContentSHA256Mismatch  = errors.New("x-amz-content-sha256 не совпадает с телом запроса")
+	ErrChunkSignatureMismatch = errors.New("подпись aws-chunked фрагмента не совпадает")
+)
+
+var credentialStore map[string]string
+
+// LoadCredentials читает CSV-файл с колонками AccessKey,SecretKey.
+// После загрузки все запросы к серверу требуют подписи SigV4.
+func LoadCredentials(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть файл ключей доступа: %v", err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать файл ключей доступа: %v", err)
+	}
+
+	store := make(map[string]string)
+	for i, record := range records {
+		if i == 0 || len(record) < 2 {
+			continue
+		}
+		store[record[0]] = record[1]
+	}
+	if len(store) == 0 {
+		return fmt.Errorf("файл ключей доступа %s не содержит ни одного ключа", path)
+	}
+	credentialStore = store
+	return nil
+}
+
+func AuthEnabled() bool {
+	return len(credentialStore) > 0
+}
+
+type authError struct {
+	statusCode int
+	code       string
+	message    string
+}
+
+func (e *authError) Error() string {
+	return e.message
+}
+
+func accessDenied(message string) *authError {
+	return &authError{http.StatusForbidden, "AccessDenied", message}
+}
+
+func signatureMismatch() *authError {
+	return &authError{http.StatusForbidden, "SignatureDoesNotMatch", "Подпись запроса не совпадает с вычисленной"}
+}
+
+func malformedAuth(message string) *authError {
+	return &authError{http.StatusBadRequest, "AuthorizationHeaderMalformed", message}
+}
+
+// signV4Request — разобранные параметры подписи из заголовка Authorization или query-строки.
+type signV4Request struct {
+	accessKey     string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	amzDate       time.Time
+	presigned     bool
+	expires       int
+}
+
+func (s *signV4Request) scope() string {
+	return strings.Join([]string{s.date, s.region, s.service, "aws4_request"}, "/")
+}
+
+// Authenticate проверяет подпись запроса и пишет ошибку в ответ, если проверка не пройдена.
+func Authenticate(w http.ResponseWriter, r *http.Request) bool {
+	if !AuthEnabled() {
+		return true
+	}
+	if err := verifyRequest(r); err != nil {
+		WriteS3Error(w, r, err.statusCode, err.code, err.message)
+		return false
+	}
+	return true
+}
+
+// writePayloadError отвечает клиенту, если чтение тела прервалось из-за неверной подписи содержимого.
+func writePayloadError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, ErrContentSHA256Mismatch):
+		WriteS3Error(w, r, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "Хеш тела запроса не совпадает с x-amz-content-sha256")
+	case errors.Is(err, ErrChunkSignatureMismatch):
+		WriteS3Error(w, r, http.StatusForbidden, "SignatureDoesNotMatch", "Подпись фрагмента тела запроса не совпадает с вычисленной")
+	default:
+		return false
+	}
+	return true
+}
+
+func verifyRequest(r *http.Request) *authError {
+	var (
+		sig *signV4Request
+		err *authError
+	)
+	switch {
+	case r.Header.Get("Authorization") != "" && hasPresignedQuery(r):
+		return &authError{http.StatusBadRequest, "InvalidArgument", "Запрос должен быть подписан либо заголовком Authorization, либо параметрами X-Amz-*"}
+	case r.Header.Get("Authorization") != "":
+		sig, err = parseAuthorizationHeader(r)
+	case r.URL.Query().Get("X-Amz-Algorithm") != "":
+		sig, err = parsePresignedQuery(r)
+	default:
+		return accessDenied("Доступ запрещён: запрос не подписан")
+	}
+	if err != nil {
+		return err
+	}
+
+	secretKey, ok := credentialStore[sig.accessKey]
+	if !ok {
+		return &authError{http.StatusForbidden, "InvalidAccessKeyId", "Указанный ключ доступа не существует"}
+	}
+
+	if sig.presigned {
+		if err := checkPresignedExpiry(sig); err != nil {
+			return err
+		}
+	} else if now := time.Now().UTC(); sig.amzDate.Before(now.Add(-maxClockSkew)) || sig.amzDate.After(now.Add(maxClockSkew)) {
+		return &authError{http.StatusForbidden, "RequestTimeTooSkewed", "Время запроса слишком отличается от времени сервера"}
+	}
+
+	payloadHash := unsignedPayload
+	if !sig.presigned {
+		payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+		if payloadHash == "" {
+			return &authError{http.StatusBadRequest, "InvalidRequest", "Отсутствует заголовок x-amz-content-sha256"}
+		}
+	} else if value := r.URL.Query().Get("X-Amz-Content-Sha256"); value != "" {
+		payloadHash = value
+	}
+
+	canonicalRequest := buildCanonicalRequest(r, sig.signedHeaders, payloadHash, sig.presigned)
+	signingKey := deriveSigningKey(secretKey, sig.date, sig.region, sig.service)
+	stringToSign := strings.Join([]string{
+		signV4Algorithm,
+		sig.amzDate.Format(amzDateFormat),
+		sig.scope(),
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(signingKey, []byte(stringToSign)))
+	if !hmac.Equal([]byte(expected), []byte(sig.signature)) {
+		return signatureMismatch()
+	}
+
+	switch payloadHash {
+	case unsignedPayload:
+	case streamingPayload:
+		r.Body = &chunkedReader{
+			body:          r.Body,
+			reader:        bufio.NewReader(r.Body),
+			signingKey:    signingKey,
+			amzDate:       sig.amzDate.Format(amzDateFormat),
+			scope:         sig.scope(),
+			prevSignature: sig.signature,
+			signed:        true,
+		}
+		setDecodedContentLength(r)
+	case streamingUnsigned:
+		r.Body = &chunkedReader{body: r.Body, reader: bufio.NewReader(r.Body)}
+		setDecodedContentLength(r)
+	default:
+		if len(payloadHash) != sha256.Size*2 {
+			return &authError{http.StatusBadRequest, "InvalidArgument", "Некорректное значение x-amz-content-sha256"}
+		}
+		r.Body = &sha256Reader{body: r.Body, hash: sha256.New(), expected: payloadHash}
+	}
+	return nil
+}
+
+func setDecodedContentLength(r *http.Request) {
+	if value := r.Header.Get("X-Amz-Decoded-Content-Length"); value != "" {
+		if length, err := strconv.ParseInt(value, 10, 64); err == nil {
+			r.ContentLength = length
+		}
+	}
+}
+
+func parseAuthorizationHeader(r *http.Request) (*signV4Request, *authError) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, signV4Algorithm+" ") {
+		return nil, malformedAuth("Поддерживается только алгоритм подписи AWS4-HMAC-SHA256")
+	}
+
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(header, signV4Algorithm+" "), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, malformedAuth("Некорректный заголовок Authorization")
+		}
+		fields[key] = value
+	}
+
+	sig, err := parseCredential(fields["Credential"])
+	if err != nil {
+		return nil, err
+	}
+	sig.signedHeaders = strings.Split(fields["SignedHeaders"], ";")
+	sig.signature = fields["Signature"]
+	if fields["SignedHeaders"] == "" || sig.signature == "" {
+		return nil, malformedAuth("В заголовке Authorization отсутствуют SignedHeaders или Signature")
+	}
+	if !slices.Contains(sig.signedHeaders, "host") {
+		return nil, malformedAuth("Заголовок host должен входить в SignedHeaders")
+	}
+
+	dateValue := r.Header.Get("X-Amz-Date")
+	if dateValue != "" {
+		amzDate, parseErr := time.Parse(amzDateFormat, dateValue)
+		if parseErr != nil {
+			return nil, accessDenied("Некорректный заголовок X-Amz-Date")
+		}
+		sig.amzDate = amzDate
+	} else {
+		amzDate, parseErr := http.ParseTime(r.Header.Get("Date"))
+		if parseErr != nil {
+			return nil, accessDenied("Отсутствует заголовок X-Amz-Date или Date")
+		}
+		sig.amzDate = amzDate.UTC()
+	}
+	if sig.amzDate.Format("20060102") != sig.date {
+		return nil, malformedAuth("Дата в области учётных данных не совпадает с датой запроса")
+	}
+	return sig, nil
+}
+
+func parsePresignedQuery(r *http.Request) (*signV4Request, *authError) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != signV4Algorithm {
+		return nil, &authError{http.StatusBadRequest, "AuthorizationQueryParametersError", "Поддерживается только алгоритм подписи AWS4-HMAC-SHA256"}
+	}
+
+	sig, err := parseCredential(query.Get("X-Amz-Credential"))
+	if err != nil {
+		return nil, err
+	}
+	sig.presigned = true
+	sig.signedHeaders = strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+	sig.signature = query.Get("X-Amz-Signature")
+	if query.Get("X-Amz-SignedHeaders") == "" || sig.signature == "" {
+		return nil, &authError{http.StatusBadRequest, "AuthorizationQueryParametersError", "Отсутствуют X-Amz-SignedHeaders или X-Amz-Signature"}
+	}
+	if !slices.Contains(sig.signedHeaders, "host") {
+		return nil, &authError{http.StatusBadRequest, "AuthorizationQueryParametersError", "Заголовок host должен входить в X-Amz-SignedHeaders"}
+	}
+
+	amzDate, parseErr := time.Parse(amzDateFormat, query.Get("X-Amz-Date"))
+	if parseErr != nil {
+		return nil, &authError{http.StatusBadRequest, "AuthorizationQueryParametersError", "Некорректный параметр X-Amz-Date"}
+	}
+	sig.amzDate = amzDate
+
+	expires, parseErr := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if parseErr != nil || expires < 1 || expires > maxPresignExpires {
+		return nil, &authError{http.StatusBadRequest, "AuthorizationQueryParametersError", "X-Amz-Expires должен быть от 1 до 604800 секунд"}
+	}
+	sig.expires = expires
+	return sig, nil
+}
+
+func parseCredential(credential string) (*signV4Request, *authError) {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return nil, malformedAuth("Некорректный формат Credential")
+	}
+	if parts[3] != "s3" {
+		return nil, malformedAuth("Область учётных данных должна относиться к сервису s3")
+	}
+	return &signV4Request{accessKey: parts[0], date: parts[1], region: parts[2], service: parts[3]}, nil
+}
+
+func buildCanonicalRequest(r *http.Request, signedHeaders []string, payloadHash string, presigned bool) string {
+	segments := strings.Split(r.URL.Path, "/")
+	for i, segment := range segments {
+		segments[i] = s3URIEncode(segment)
+	}
+	canonicalURI := strings.Join(segments, "/")
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+
+	query := r.URL.Query()
+	if presigned {
+		query.Del("X-Amz-Signature")
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var queryParts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			queryParts = append(queryParts, s3URIEncode(key)+"="+s3URIEncode(value))
+		}
+	}
+
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		headers.WriteString(name)
+		headers.WriteString(":")
+		headers.WriteString(canonicalHeaderValue(r, name))
+		headers.WriteString("\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		canonicalURI,
+		strings.Join(queryParts, "&"),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+func canonicalHeaderValue(r *http.Request, name string) string {
+	var values []string
+	switch name {
+	case "host":
+		values = []string{r.Host}
+	case "content-length":
+		values = r.Header.Values("Content-Length")
+		if len(values) == 0 && r.ContentLength >= 0 {
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		}
+	case "transfer-encoding":
+		values = r.TransferEncoding
+	default:
+		values = r.Header.Values(name)
+	}
+	for i, value := range values {
+		values[i] = strings.Join(strings.Fields(value), " ")
+	}
+	return strings.Join(values, ",")
+}
+
+func s3URIEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func deriveSigningKey(secretKey, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), []byte(date))
+	key = hmacSHA256(key, []byte(region))
+	key = hmacSHA256(key, []byte(service))
+	return hmacSHA256(key, []byte("aws4_request"))
+}
+
+// sha256Reader сверяет хеш тела с x-amz-content-sha256, когда тело прочитано до конца.
+type sha256Reader struct {
+	body     io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (s *sha256Reader) Read(p []byte) (int, error) {
+	n, err := s.body.Read(p)
+	s.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(s.hash.Sum(nil)) != s.expected {
+		return n, ErrContentSHA256Mismatch
+	}
+	return n, err
+}
+
+func (s *sha256Reader) Close() error {
+	return s.body.Close()
+}
+
+// chunkedReader декодирует тело в формате aws-chunked и, для подписанного варианта,
+// проверяет подпись каждого фрагмента по цепочке от подписи запроса.
+type chunkedReader struct {
+	body          io.ReadCloser
+	reader        *bufio.Reader
+	signingKey    []byte
+	amzDate       string
+	scope         string
+	prevSignature string
+	signed        bool
+	chunk         []byte
+	done          bool
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for len(c.chunk) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.chunk)
+	c.chunk = c.chunk[n:]
+	return n, nil
+}
+
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("некорректный aws-chunked фрагмент: %v", err)
+	}
+	sizeField, signature, _ := strings.Cut(strings.TrimRight(line, "\r\n"), ";")
+	size, err := strconv.ParseInt(sizeField, 16, 64)
+	if err != nil || size < 0 || size > maxChunkSize {
+		return fmt.Errorf("некорректный размер aws-chunked фрагмента: %q", sizeField)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return fmt.Errorf("обрыв aws-chunked фрагмента: %v", err)
+	}
+
+	if c.signed {
+		signature = strings.TrimPrefix(signature, "chunk-signature=")
+		stringToSign := strings.Join([]string{
+			signV4ChunkAlgorithm,
+			c.amzDate,
+			c.scope,
+			c.prevSignature,
+			emptySHA256,
+			hexSHA256(data),
+		}, "\n")
+		expected := hex.EncodeToString(hmacSHA256(c.signingKey, []byte(stringToSign)))
+		if !hmac.Equal([]byte(expected), []byte(signature)) {
+			return ErrChunkSignatureMismatch
+		}
+		c.prevSignature = signature
+	}
+
+	if size == 0 {
+		c.done = true
+		// Трейлеры (контрольные суммы) заканчиваются пустой строкой.
+		for {
+			line, err := c.reader.ReadString('\n')
+			if strings.TrimRight(line, "\r\n") == "" || err != nil {
+				break
+			}
+		}
+		return nil
+	}
+
+	crlf := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, crlf); err != nil || !bytes.Equal(crlf, []byte("\r\n")) {
+		return fmt.Errorf("некорректное окончание aws-chunked фрагмента")
+	}
+	c.chunk = data
+	return nil
+}
+
+func (c *chunkedReader) Close() error {
+	return c.body.Close()
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Backend хранит содержимое объектов. Метаданные живут отдельно, в MetadataStore.
+// Stage полностью записывает содержимое во временное хранилище; под именем объекта оно
+// появляется только после Commit, так что читатели никогда не видят недописанный объект.
+// Get и Stat возвращают ошибку, для которой os.IsNotExist истинно, если объекта нет.
+// List обходит все объекты бакета, порядок обхода не гарантируется.
+type Backend interface {
+	MakeBucket(bucketName string) error
+	RemoveBucket(bucketName string) error
+
+	Stage(bucketName, objectName string, r io.Reader) (StagedObject, error)
+	Get(bucketName, objectName string) (io.ReadSeekCloser, error)
+	Stat(bucketName, objectName string) (ObjectInfo, error)
+	Delete(bucketName, objectName string) error
+	List(bucketName string, fn func(ObjectInfo) error) error
+}
+
+// StagedObject — записанное, но ещё не опубликованное содержимое объекта.
+// Commit атомарно ставит его на место объекта; object — запись, которая будет сохранена
+// в метаданных сразу после Commit: по ней восстановление после сбоя решает, дошла ли загрузка
+// до метаданных. Rollback после Commit возвращает прежнее содержимое или удаляет объект,
+// если его не было: так откатывается загрузка, для которой не удалось записать метаданные.
+// Close освобождает временные данные и вызывается всегда, до того как отпущен замок ключа.
+type StagedObject interface {
+	Size() int64
+	Commit(object ObjectMetadata) error
+	Rollback() error
+	Close() error
+}
+
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+var ObjectBackend Backend
+
+// NewBackend создаёт хранилище данных выбранного типа: fs или memory.
+func NewBackend(kind, baseDir string) (Backend, error) {
+	switch kind {
+	case "fs":
+		return NewFSBackend(baseDir), nil
+	case "memory":
+		return NewMemoryBackend(), nil
+	default:
+		return nil, fmt.Errorf("неизвестный тип хранилища данных: %s", kind)
+	}
+}
+
+// FSBackend раскладывает объекты по файлам {baseDir}/{bucket}/{key}.
+type FSBackend struct {
+	baseDir string
+}
+
+func NewFSBackend(baseDir string) *FSBackend {
+	return &FSBackend{baseDir: baseDir}
+}
+
+func (b *FSBackend) objectPath(bucketName, objectName string) string {
+	return filepath.Join(b.baseDir, bucketName, filepath.FromSlash(objectName))
+}
+
+func (b *FSBackend) MakeBucket(bucketName string) error {
+	return os.MkdirAll(filepath.Join(b.baseDir, bucketName), 0o755)
+}
+
+func (b *FSBackend) RemoveBucket(bucketName string) error {
+	return os.RemoveAll(filepath.Join(b.baseDir, bucketName))
+}
+
+// stagingDir хранит загрузки до Commit. Она лежит внутри бакета, чтобы переименование
+// на место объекта не пересекало границу файловой системы.
+func (b *FSBackend) stagingDir(bucketName string) string {
+	return filepath.Join(b.baseDir, bucketName, systemDirName, "staging")
+}
+
+func (b *FSBackend) Stage(bucketName, objectName string, r io.Reader) (StagedObject, error) {
+	dir := b.stagingDir(bucketName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("не удалось создать директорию для загрузки: %v", err)
+	}
+	file, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать объект: %v", err)
+	}
+
+	// CreateTemp создаёт файл с правами 0600, а объекты всегда были доступны на чтение всем.
+	err = file.Chmod(0o644)
+	var written int64
+	if err == nil {
+		written, err = io.Copy(file, r)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &fsStagedObject{backend: b, bucketName: bucketName, objectName: objectName, tempPath: file.Name(), size: written}, nil
+}
+
+type fsStagedObject struct {
+	backend     *FSBackend
+	bucketName  string
+	objectName  string
+	tempPath    string
+	backupPath  string
+	journalPath string
+	size        int64
+	committed   bool
+}
+
+func (s *fsStagedObject) Size() int64 {
+	return s.size
+}
+
+func (s *fsStagedObject) Commit(object ObjectMetadata) error {
+	objectPath := s.backend.objectPath(s.bucketName, s.objectName)
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0o755); err != nil {
+		return fmt.Errorf("не удалось создать директории для объекта: %v", err)
+	}
+
+	// Прежнее содержимое остаётся доступным по жёсткой ссылке до Close, чтобы его можно было вернуть.
+	backupPath := s.tempPath + backupFileSuffix
+	if err := os.Link(objectPath, backupPath); err == nil {
+		s.backupPath = backupPath
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("не удалось сохранить прежнюю версию объекта: %v", err)
+	}
+
+	// Журнал должен попасть на диск раньше, чем объект окажется на своём месте.
+	journal := commitJournal{ObjectName: s.objectName, HasBackup: s.backupPath != "", Object: object}
+	s.journalPath = s.tempPath + journalFileSuffix
+	if err := writeCommitJournal(s.journalPath, journal); err != nil {
+		return fmt.Errorf("не удалось записать журнал загрузки: %v", err)
+	}
+
+	if err := os.Rename(s.tempPath, objectPath); err != nil {
+		return fmt.Errorf("не удалось сохранить объект: %v", err)
+	}
+	s.tempPath = ""
+	s.committed = true
+
+	if err := syncDir(filepath.Dir(objectPath)); err != nil {
+		s.Rollback()
+		return fmt.Errorf("не удалось сохранить объект: %v", err)
+	}
+	return nil
+}
+
+// Рядом с временным файлом загрузки на время от Commit до Close лежат резервная ссылка
+// на прежнее содержимое и журнал, по которому RecoverDataDir доводит прерванную загрузку.
+const (
+	backupFileSuffix  = ".prev"
+	journalFileSuffix = ".commit"
+)
+
+// commitJournal описывает загрузку между Commit и Close: куда поставлено содержимое,
+// осталась ли копия прежнего и какую запись собирались сохранить в метаданных.
+type commitJournal struct {
+	ObjectName string
+	HasBackup  bool
+	Object     ObjectMetadata
+}
+
+func writeCommitJournal(path string, journal commitJournal) error {
+	hasBackup := ""
+	if journal.HasBackup {
+		hasBackup = "true"
+	}
+	return writeFileAtomic(path, filepath.Dir(path), func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		writer.Write([]string{journal.ObjectName, hasBackup})
+		writer.Write(objectToRecord(journal.Object))
+		writer.Flush()
+		return writer.Error()
+	})
+}
+
+func readCommitJournal(path string) (commitJournal, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return commitJournal{}, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return commitJournal{}, err
+	}
+	if len(records) != 2 || len(records[0]) != 2 {
+		return commitJournal{}, fmt.Errorf("неверный формат журнала загрузки")
+	}
+	object, err := recordToObject(records[1])
+	if err != nil {
+		return commitJournal{}, err
+	}
+	return commitJournal{ObjectName: records[0][0], HasBackup: records[0][1] == "true", Object: object}, nil
+}
+
+func (s *fsStagedObject) Rollback() error {
+	if !s.committed {
+		return nil
+	}
+	s.committed = false
+
+	if s.backupPath == "" {
+		return s.backend.Delete(s.bucketName, s.objectName)
+	}
+	objectPath := s.backend.objectPath(s.bucketName, s.objectName)
+	if err := os.Rename(s.backupPath, objectPath); err != nil {
+		return err
+	}
+	s.backupPath = ""
+	return syncDir(filepath.Dir(objectPath))
+}
+
+func (s *fsStagedObject) Close() error {
+	if s.tempPath != "" {
+		os.Remove(s.tempPath)
+	}
+	if s.backupPath != "" {
+		os.Remove(s.backupPath)
+	}
+	// Журнал удаляется последним: пока он есть, восстановление знает, как поступить с объектом.
+	if s.journalPath != "" {
+		os.Remove(s.journalPath)
+	}
+	return nil
+}
+
+func (b *FSBackend) Get(bucketName, objectName string) (io.ReadSeekCloser, error) {
+	file, err := os.Open(b.objectPath(bucketName, objectName))
+	if err != nil {
+		return nil, err
+	}
+	if info, err := file.Stat(); err != nil || info.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+	return file, nil
+}
+
+func (b *FSBackend) Stat(bucketName, objectName string) (ObjectInfo, error) {
+	info, err := os.Stat(b.objectPath(bucketName, objectName))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, os.ErrNotExist
+	}
+	return ObjectInfo{Key: objectName, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete удаляет файл объекта и опустевшие директории над ним, чтобы бакет снова считался пустым.
+func (b *FSBackend) Delete(bucketName, objectName string) error {
+	objectPath := b.objectPath(bucketName, objectName)
+	if err := os.Remove(objectPath); err != nil {
+		return err
+	}
+
+	bucketDir := filepath.Join(b.baseDir, bucketName)
+	for dir := filepath.Dir(objectPath); dir != bucketDir && strings.HasPrefix(dir, bucketDir); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (b *FSBackend) List(bucketName string, fn func(ObjectInfo) error) error {
+	bucketDir := filepath.Join(b.baseDir, bucketName)
+	return filepath.WalkDir(bucketDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == bucketDir {
+			return nil
+		}
+
+		rel, err := filepath.Rel(bucketDir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if isReservedObjectName(key) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return fn(ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+	})
+}
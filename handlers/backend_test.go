@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func readBackendObject(t *testing.T, backend Backend, bucketName, objectName string) (string, bool) {
+	t.Helper()
+	file, err := backend.Get(bucketName, objectName)
+	if os.IsNotExist(err) {
+		return "", false
+	} else if err != nil {
+		t.Fatalf("Get %s: %v", objectName, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("чтение %s: %v", objectName, err)
+	}
+	return string(data), true
+}
+
+func mustStage(t *testing.T, backend Backend, bucketName, objectName, data string) StagedObject {
+	t.Helper()
+	staged, err := backend.Stage(bucketName, objectName, strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Stage %s: %v", objectName, err)
+	}
+	if staged.Size() != int64(len(data)) {
+		t.Fatalf("Size() = %d, ожидалось %d", staged.Size(), len(data))
+	}
+	return staged
+}
+
+func TestBackendStaging(t *testing.T) {
+	backends := map[string]func(t *testing.T) Backend{
+		"fs":     func(t *testing.T) Backend { return NewFSBackend(t.TempDir()) },
+		"memory": func(t *testing.T) Backend { return NewMemoryBackend() },
+	}
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			backend := newBackend(t)
+			if err := backend.MakeBucket("stage-bucket"); err != nil {
+				t.Fatalf("MakeBucket: %v", err)
+			}
+
+			staged := mustStage(t, backend, "stage-bucket", "dir/key", "one")
+			if _, ok := readBackendObject(t, backend, "stage-bucket", "dir/key"); ok {
+				t.Fatal("объект виден до Commit")
+			}
+			if err := staged.Commit(ObjectMetadata{Key: "dir/key"}); err != nil {
+				t.Fatalf("Commit: %v", err)
+			}
+			staged.Close()
+			if data, _ := readBackendObject(t, backend, "stage-bucket", "dir/key"); data != "one" {
+				t.Fatalf("после Commit: %q", data)
+			}
+
+			// Откат перезаписи возвращает прежнее содержимое.
+			staged = mustStage(t, backend, "stage-bucket", "dir/key", "two")
+			if err := staged.Commit(ObjectMetadata{Key: "dir/key"}); err != nil {
+				t.Fatalf("Commit: %v", err)
+			}
+			if data, _ := readBackendObject(t, backend, "stage-bucket", "dir/key"); data != "two" {
+				t.Fatalf("после второго Commit: %q", data)
+			}
+			if err := staged.Rollback(); err != nil {
+				t.Fatalf("Rollback: %v", err)
+			}
+			staged.Close()
+			if data, _ := readBackendObject(t, backend, "stage-bucket", "dir/key"); data != "one" {
+				t.Errorf("после Rollback: %q", data)
+			}
+
+			// Откат загрузки нового ключа удаляет объект.
+			staged = mustStage(t, backend, "stage-bucket", "new", "x")
+			if err := staged.Commit(ObjectMetadata{Key: "new"}); err != nil {
+				t.Fatalf("Commit: %v", err)
+			}
+			staged.Rollback()
+			staged.Close()
+			if _, ok := readBackendObject(t, backend, "stage-bucket", "new"); ok {
+				t.Error("новый объект остался после Rollback")
+			}
+
+			// Close без Commit просто выбрасывает загрузку.
+			staged = mustStage(t, backend, "stage-bucket", "dropped", "x")
+			staged.Close()
+			if _, ok := readBackendObject(t, backend, "stage-bucket", "dropped"); ok {
+				t.Error("объект появился без Commit")
+			}
+
+			var keys []string
+			backend.List("stage-bucket", func(info ObjectInfo) error {
+				keys = append(keys, info.Key)
+				return nil
+			})
+			sort.Strings(keys)
+			if strings.Join(keys, ",") != "dir/key" {
+				t.Errorf("List: %q", keys)
+			}
+		})
+	}
+}
+
+func TestFSBackendStagingLeftovers(t *testing.T) {
+	baseDir := t.TempDir()
+	backend := NewFSBackend(baseDir)
+	backend.MakeBucket("stage-bucket")
+
+	staged := mustStage(t, backend, "stage-bucket", "key", "one")
+	staged.Commit(ObjectMetadata{Key: "key"})
+	staged.Close()
+	staged = mustStage(t, backend, "stage-bucket", "key", "two")
+	staged.Commit(ObjectMetadata{Key: "key"})
+	staged.Close()
+	mustStage(t, backend, "stage-bucket", "dropped", "x").Close()
+
+	entries, err := os.ReadDir(backend.stagingDir("stage-bucket"))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("после Close в staging остались файлы: %v", entries)
+	}
+	info, err := os.Stat(filepath.Join(baseDir, "stage-bucket", "key"))
+	if err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("права объекта: %v %v", info, err)
+	}
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"encoding/csv"
 	"encoding/xml"
 	"net"
 	"net/http"
@@ -55,114 +54,101 @@ func isValidBucketName(bucketName string) bool {
 
 func CreateBucketHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "PUT" {
-		WriteXMLResponse(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
 		return
 	}
 
 	bucketName := strings.TrimPrefix(r.URL.Path, "/")
 	if bucketName == "" {
-		WriteXMLResponse(w, http.StatusBadRequest, "BucketnameIsNotExits", "Название бакета не указано")
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidBucketName", "Название бакета не указано")
 		return
 	}
 
 	if !isValidBucketName(bucketName) {
-		WriteXMLResponse(w, http.StatusBadRequest, "UnvaliabaleName", "Недопустимое имя бакета")
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidBucketName", "Недопустимое имя бакета")
 		return
 	}
 
-	bucketDir := filepath.Join(BaseDir, bucketName)
-
-	if _, err := os.Stat(bucketDir); !os.IsNotExist(err) {
-		WriteXMLResponse(w, http.StatusConflict, "Already exists", "Бакет уже существует")
-		return
-	}
-
-	if err := os.MkdirAll(bucketDir, 0o755); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "CouldntCreate", "Ошибка создания директории бакета")
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
 		return
 	}
-
-	objectMetadataPath := filepath.Join(bucketDir, "objects.csv")
-	file, err := os.Create(objectMetadataPath)
-	if err != nil {
-		WriteXMLResponse(w, http.StatusBadRequest, "CouldntCreateFile", "Ошибка создания xml файла")
+	if exists {
+		WriteS3Error(w, r, http.StatusConflict, "BucketAlreadyOwnedByYou", "Бакет уже существует")
 		return
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	if err := writer.Write([]string{"ObjectName", "Size", "ContentType", "LastModified"}); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "CouldntWriteHeader", "Ошибка записи заголовков в objects.csv")
+	if err := ObjectBackend.MakeBucket(bucketName); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка создания директории бакета")
 		return
 	}
 
 	timestamp := time.Now().UTC().Format(time.RFC3339)
-	if err := AddBucketToMetadata(bucketName, timestamp); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "CouldntUpdateMetada", "Ошибка добавления метаданных")
+	bucket := BucketMetadata{Name: bucketName, CreationTime: timestamp, LastModified: timestamp, Status: "Inactive"}
+	if err := Store.PutBucket(bucket); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка добавления метаданных")
 		return
 	}
 
-	WriteXMLResponse(w, http.StatusCreated, "Success", "Bucket успешно создан")
+	w.Header().Set("Location", "/"+bucketName)
+	w.WriteHeader(http.StatusOK)
 }
 
 func DeleteBucketHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "DELETE" {
-		WriteXMLResponse(w, http.StatusMethodNotAllowed, "Not Allowed", "Метод не поддерживается")
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
 		return
 	}
 
 	bucketName := strings.TrimPrefix(r.URL.Path, "/")
 	if bucketName == "" {
-		WriteXMLResponse(w, http.StatusBadRequest, "Backet name not exists", "Название бакета не указано")
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidBucketName", "Название бакета не указано")
 		return
 	}
 
 	if bucketName == "buckets.csv" {
-		WriteXMLResponse(w, http.StatusBadRequest, "Forbidden", "Удаление файла buckets.csv запрещено")
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidBucketName", "Удаление файла buckets.csv запрещено")
 		return
 	}
 
 	exists, err := isBucketInMetadata(bucketName)
 	if err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "Error of metadata", "Ошибка чтения файла метаданных бакетов")
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
 		return
 	}
 	if !exists {
-		WriteXMLResponse(w, http.StatusNotFound, "Couldn't DELETE", "Бакет не найден в метаданных, удаление запрещено")
-		return
-	}
-
-	bucketDir := filepath.Join(BaseDir, bucketName)
-
-	if _, err := os.Stat(bucketDir); os.IsNotExist(err) {
-		WriteXMLResponse(w, http.StatusNotFound, "Not Found", "Бакет не найден")
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден в метаданных, удаление запрещено")
 		return
 	}
 
-	entries, err := os.ReadDir(bucketDir)
+	empty, err := isBucketEmpty(bucketName)
 	if err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "Error of reading file", "Ошибка чтения содержимого бакета")
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения содержимого бакета")
 		return
 	}
 
-	if len(entries) > 1 || (len(entries) == 1 && entries[0].Name() != "objects.csv") {
-		WriteXMLResponse(w, http.StatusConflict, "Buscket not empty", "Бакет не пуст, удаление запрещено")
+	if !empty {
+		WriteS3Error(w, r, http.StatusConflict, "BucketNotEmpty", "Бакет не пуст, удаление запрещено")
 		return
 	}
 
-	if err := os.RemoveAll(bucketDir); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "Error of delete", "Ошибка удаления директории бакета")
+	// Служебная директория с незавершёнными multipart-загрузками всегда лежит на диске.
+	os.RemoveAll(filepath.Join(BaseDir, bucketName, systemDirName))
+
+	if err := Store.DeleteBucket(bucketName); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка удаления записи из файла метаданных")
 		return
 	}
 
-	if err := RemoveBucketFromMetadata(bucketName); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "Couldn't DELETE", "Ошибка удаления записи из файла метаданных")
+	if err := ObjectBackend.RemoveBucket(bucketName); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка удаления директории бакета")
 		return
 	}
+	// Пустая директория могла остаться от метаданных, если данные хранятся не на диске.
+	os.Remove(filepath.Join(BaseDir, bucketName))
 
-	WriteXMLResponse(w, 204, "Successful", "Бакет успешно создан !")
+	w.WriteHeader(http.StatusNoContent)
 }
 
 type Bucket struct {
@@ -176,27 +162,25 @@ type ListBucketsResponse struct {
 
 func ListBucketsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
-		WriteXMLResponse(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
 		return
 	}
 
-	entries, err := os.ReadDir(BaseDir)
+	metadata, err := Store.ListBuckets()
 	if err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "InternalError", "Ошибка чтения директории")
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
 		return
 	}
 
 	var buckets []Bucket
-	for _, entry := range entries {
-		if entry.IsDir() {
-			buckets = append(buckets, Bucket{Name: entry.Name()})
-		}
+	for _, bucket := range metadata {
+		buckets = append(buckets, Bucket{Name: bucket.Name})
 	}
 
 	response := ListBucketsResponse{Buckets: buckets}
 	w.Header().Set("Content-Type", "application/xml")
 	w.WriteHeader(http.StatusOK)
 	if err := xml.NewEncoder(w).Encode(response); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "InternalError", "Ошибка формирования ответа")
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка формирования ответа")
 	}
 }
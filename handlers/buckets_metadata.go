@@ -3,166 +3,186 @@ package handlers
 import (
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
 )
 
-var metadataLock sync.Mutex
+var metadataLock sync.RWMutex
 
-var MetadataFilePath string
+var bucketsCSVHeader = []string{"Name", "CreationTime", "LastModified", "Status", "Versioning"}
 
-func InitializeMetadataFile(baseDir string) error {
-	MetadataFilePath = filepath.Join(baseDir, "buckets.csv")
+// CSVStore хранит бакеты в buckets.csv, а объекты — в objects.csv внутри каждого бакета.
+// Любое изменение перечитывает и переписывает файл целиком.
+type CSVStore struct {
+	baseDir          string
+	metadataFilePath string
+}
 
-	if _, err := os.Stat(MetadataFilePath); os.IsNotExist(err) {
-		file, err := os.Create(MetadataFilePath)
-		if err != nil {
-			return fmt.Errorf("не удалось создать файл метаданных: %v", err)
-		}
-		defer file.Close()
+func NewCSVStore(baseDir string) (*CSVStore, error) {
+	store := &CSVStore{baseDir: baseDir, metadataFilePath: filepath.Join(baseDir, "buckets.csv")}
+	if err := store.initializeMetadataFile(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
 
-		writer := csv.NewWriter(file)
-		defer writer.Flush()
-		err = writer.Write([]string{"Name", "CreationTime", "LastModified", "Status"})
-		if err != nil {
-			return fmt.Errorf("не удалось записать заголовки в файл метаданных: %v", err)
-		}
+func (s *CSVStore) initializeMetadataFile() error {
+	if _, err := os.Stat(s.metadataFilePath); os.IsNotExist(err) {
+		return s.writeBuckets(nil)
 	}
 	return nil
 }
 
-func isBucketInMetadata(bucketName string) (bool, error) {
-	file, err := os.Open(filepath.Join(BaseDir, "buckets.csv"))
+func (s *CSVStore) readBuckets() ([]BucketMetadata, error) {
+	file, err := os.Open(s.metadataFilePath)
 	if err != nil {
-		return false, fmt.Errorf("не удалось открыть файл метаданных: %v", err)
+		return nil, fmt.Errorf("не удалось открыть файл метаданных: %v", err)
 	}
 	defer file.Close()
 
 	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
 	records, err := reader.ReadAll()
 	if err != nil {
-		return false, fmt.Errorf("не удалось прочитать файл метаданных: %v", err)
+		return nil, fmt.Errorf("не удалось прочитать файл метаданных: %v", err)
 	}
 
-	for _, record := range records {
-		if len(record) > 0 && record[0] == bucketName {
-			return true, nil
+	var buckets []BucketMetadata
+	for i, record := range records {
+		if i == 0 || len(record) == 0 {
+			continue
 		}
-	}
-	return false, nil
+		record = padRecord(record, len(bucketsCSVHeader))
+		buckets = append(buckets, BucketMetadata{
+			Name:         record[0],
+			CreationTime: record[1],
+			LastModified: record[2],
+			Status:       record[3],
+			Versioning:   record[4],
+		})
+	}
+	return buckets, nil
 }
 
-func AddBucketToMetadata(bucketName, creationTime string) error {
-	metadataLock.Lock()
-	defer metadataLock.Unlock()
-
-	file, err := os.OpenFile(MetadataFilePath, os.O_APPEND|os.O_WRONLY, 0o644)
+func (s *CSVStore) writeBuckets(buckets []BucketMetadata) error {
+	err := writeFileAtomic(s.metadataFilePath, s.baseDir, func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		writer.Write(bucketsCSVHeader)
+		for _, bucket := range buckets {
+			writer.Write([]string{bucket.Name, bucket.CreationTime, bucket.LastModified, bucket.Status, bucket.Versioning})
+		}
+		writer.Flush()
+		return writer.Error()
+	})
 	if err != nil {
-		return fmt.Errorf("не удалось открыть файл метаданных для записи: %v", err)
+		return fmt.Errorf("не удалось записать файл метаданных: %v", err)
 	}
-	defer file.Close()
-
-	status := "Inactive"
+	return nil
+}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+func (s *CSVStore) ListBuckets() ([]BucketMetadata, error) {
+	metadataLock.RLock()
+	defer metadataLock.RUnlock()
 
-	record := []string{bucketName, creationTime, creationTime, status}
-	if err := writer.Write(record); err != nil {
-		return fmt.Errorf("не удалось записать метаданные бакета: %v", err)
-	}
-	return nil
+	return s.readBuckets()
 }
 
-func UpdateBucketStatus(bucketName string) error {
-	metadataLock.Lock()
-	defer metadataLock.Unlock()
+func (s *CSVStore) GetBucket(bucketName string) (*BucketMetadata, error) {
+	metadataLock.RLock()
+	defer metadataLock.RUnlock()
 
-	tempFilePath := MetadataFilePath + ".tmp"
-	file, err := os.Open(MetadataFilePath)
+	buckets, err := s.readBuckets()
 	if err != nil {
-		return fmt.Errorf("не удалось открыть файл метаданных: %v", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	tempFile, err := os.Create(tempFilePath)
-	if err != nil {
-		return fmt.Errorf("не удалось создать временный файл для метаданных: %v", err)
+	for i := range buckets {
+		if buckets[i].Name == bucketName {
+			return &buckets[i], nil
+		}
 	}
-	defer tempFile.Close()
+	return nil, nil
+}
 
-	reader := csv.NewReader(file)
-	writer := csv.NewWriter(tempFile)
-	defer writer.Flush()
+func (s *CSVStore) PutBucket(bucket BucketMetadata) error {
+	metadataLock.Lock()
+	defer metadataLock.Unlock()
 
-	bucketDir := filepath.Join(BaseDir, bucketName)
-	entries, err := os.ReadDir(bucketDir)
+	buckets, err := s.readBuckets()
 	if err != nil {
-		return fmt.Errorf("не удалось прочитать содержимое бакета: %v", err)
+		return err
 	}
 
-	status := "Inactive"
-	if len(entries[1:]) > 0 {
-		status = "Active"
+	for i := range buckets {
+		if buckets[i].Name == bucket.Name {
+			buckets[i] = bucket
+			return s.writeBuckets(buckets)
+		}
 	}
 
-	records, err := reader.ReadAll()
-	if err != nil {
-		return fmt.Errorf("не удалось прочитать файл метаданных: %v", err)
-	}
+	defer bucketMetadataLocks.lock(bucket.Name)()
 
-	for _, record := range records {
-		if len(record) > 0 && record[0] == bucketName {
-			record[3] = status
+	objectMetadataPath := filepath.Join(s.baseDir, bucket.Name, "objects.csv")
+	if _, err := os.Stat(objectMetadataPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(objectMetadataPath), 0o755); err != nil {
+			return fmt.Errorf("не удалось создать директорию бакета: %v", err)
 		}
-		if err := writer.Write(record); err != nil {
-			return fmt.Errorf("не удалось записать запись в временный файл: %v", err)
+		if err := s.writeObjects(bucket.Name, newObjectIndex()); err != nil {
+			return err
 		}
 	}
-
-	if err := os.Rename(tempFilePath, MetadataFilePath); err != nil {
-		return fmt.Errorf("не удалось заменить файл метаданных: %v", err)
-	}
-	return nil
+	return s.writeBuckets(append(buckets, bucket))
 }
 
-func RemoveBucketFromMetadata(bucketName string) error {
+func (s *CSVStore) UpdateBucket(bucketName string, update func(*BucketMetadata)) (*BucketMetadata, error) {
 	metadataLock.Lock()
 	defer metadataLock.Unlock()
 
-	tempFilePath := MetadataFilePath + ".tmp"
-	file, err := os.Open(MetadataFilePath)
+	buckets, err := s.readBuckets()
 	if err != nil {
-		return fmt.Errorf("не удалось открыть файл метаданных: %v", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	tempFile, err := os.Create(tempFilePath)
-	if err != nil {
-		return fmt.Errorf("не удалось создать временный файл для метаданных: %v", err)
+	for i := range buckets {
+		if buckets[i].Name == bucketName {
+			update(&buckets[i])
+			bucket := buckets[i]
+			return &bucket, s.writeBuckets(buckets)
+		}
 	}
-	defer tempFile.Close()
+	return nil, nil
+}
 
-	reader := csv.NewReader(file)
-	writer := csv.NewWriter(tempFile)
-	defer writer.Flush()
+func (s *CSVStore) DeleteBucket(bucketName string) error {
+	metadataLock.Lock()
+	defer metadataLock.Unlock()
 
-	records, err := reader.ReadAll()
+	buckets, err := s.readBuckets()
 	if err != nil {
-		return fmt.Errorf("не удалось прочитать файл метаданных: %v", err)
+		return err
 	}
 
-	for _, record := range records {
-		if len(record) > 0 && record[0] != bucketName {
-			if err := writer.Write(record); err != nil {
-				return fmt.Errorf("не удалось записать запись в временный файл: %v", err)
-			}
+	kept := buckets[:0]
+	for _, bucket := range buckets {
+		if bucket.Name != bucketName {
+			kept = append(kept, bucket)
 		}
 	}
+	if err := s.writeBuckets(kept); err != nil {
+		return err
+	}
 
-	if err := os.Rename(tempFilePath, MetadataFilePath); err != nil {
-		return fmt.Errorf("не удалось заменить файл метаданных: %v", err)
+	defer bucketMetadataLocks.lock(bucketName)()
+	if err := os.Remove(filepath.Join(s.baseDir, bucketName, "objects.csv")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("не удалось удалить objects.csv: %v", err)
 	}
 	return nil
 }
+
+// Close дожидается записей, которые уже идут: каждая запись CSV заменяет файл целиком,
+// так что после этого на диске нет недописанных файлов метаданных.
+func (s *CSVStore) Close() error {
+	metadataLock.Lock()
+	bucketMetadataLocks.closeAll()
+	return nil
+}
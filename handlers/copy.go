@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	metadataDirectiveCopy    = "COPY"
+	metadataDirectiveReplace = "REPLACE"
+)
+
+type CopyObjectResult struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+type CopyPartResult struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyPartResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+// copySource — источник копирования, открытый для чтения расшифрованного содержимого.
+type copySource struct {
+	bucket     string
+	object     *ObjectMetadata
+	hasVersion bool
+	data       io.ReadSeekCloser
+}
+
+// parseCopySource разбирает x-amz-copy-source вида [/]bucket/key[?versionId=id].
+func parseCopySource(value string) (bucketName, objectName, versionID string, hasVersion, ok bool) {
+	path, rawQuery, _ := strings.Cut(value, "?")
+	path, err := url.PathUnescape(strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return "", "", "", false, false
+	}
+	bucketName, objectName, found := strings.Cut(path, "/")
+	if !found || bucketName == "" || objectName == "" {
+		return "", "", "", false, false
+	}
+
+	if rawQuery != "" {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil || !query.Has("versionId") {
+			return "", "", "", false, false
+		}
+		versionID, hasVersion = query.Get("versionId"), true
+		if versionID == nullVersionID {
+			versionID = ""
+		}
+	}
+	return bucketName, objectName, versionID, hasVersion, true
+}
+
+// etagMatches проверяет значение If-Match/If-None-Match: список ETag через запятую или "*".
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.Trim(candidate, "\"") == strings.Trim(etag, "\"") {
+			return true
+		}
+	}
+	return false
+}
+
+// copyConditionsMet проверяет условные заголовки x-amz-copy-source-if-*. Как и в HTTP,
+// совпавший if-match отменяет if-unmodified-since, а указанный if-none-match — if-modified-since.
+func copyConditionsMet(header http.Header, object *ObjectMetadata) bool {
+	etag := object.ETag()
+	modified := object.LastModifiedTime()
+
+	if value := header.Get("x-amz-copy-source-if-match"); value != "" {
+		if !etagMatches(value, etag) {
+			return false
+		}
+	} else if value := header.Get("x-amz-copy-source-if-unmodified-since"); value != "" {
+		if since, err := http.ParseTime(value); err == nil && modified.After(since) {
+			return false
+		}
+	}
+
+	if value := header.Get("x-amz-copy-source-if-none-match"); value != "" {
+		if etagMatches(value, etag) {
+			return false
+		}
+	} else if value := header.Get("x-amz-copy-source-if-modified-since"); value != "" {
+		if since, err := http.ParseTime(value); err == nil && !modified.After(since) {
+			return false
+		}
+	}
+	return true
+}
+
+// openCopySource находит объект из x-amz-copy-source, проверяет условия копирования
+// и открывает его содержимое. При ошибке пишет ответ сам и возвращает nil.
+func openCopySource(w http.ResponseWriter, r *http.Request) *copySource {
+	bucketName, objectName, versionID, hasVersion, ok := parseCopySource(r.Header.Get("x-amz-copy-source"))
+	if !ok {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Некорректный заголовок x-amz-copy-source")
+		return nil
+	}
+	if isReservedObjectName(objectName) {
+		WriteS3Error(w, r, http.StatusForbidden, "AccessDenied", "Копирование служебных файлов бакета запрещено")
+		return nil
+	}
+
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return nil
+	}
+	if !exists {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет источника не найден")
+		return nil
+	}
+
+	unlock := rlockObject(bucketName, objectName)
+	defer unlock()
+
+	var object *ObjectMetadata
+	if hasVersion {
+		object, err = Store.GetObjectVersion(bucketName, objectName, versionID)
+	} else {
+		object, err = Store.GetObject(bucketName, objectName)
+	}
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных объектов")
+		return nil
+	}
+	if object == nil {
+		if hasVersion {
+			WriteS3Error(w, r, http.StatusNotFound, "NoSuchVersion", "Версия источника не найдена")
+			return nil
+		}
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchKey", "Объект источника не найден")
+		return nil
+	}
+	if object.DeleteMarker {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Версия источника является маркером удаления")
+		return nil
+	}
+
+	if !copyConditionsMet(r.Header, object) {
+		WriteS3Error(w, r, http.StatusPreconditionFailed, "PreconditionFailed", "Не выполнено условие копирования")
+		return nil
+	}
+
+	dataKey, ok := openDataKey(w, r, object, copySourceSSEHeaders)
+	if !ok {
+		return nil
+	}
+
+	data, err := ObjectBackend.Get(bucketName, versionDataName(objectName, object.VersionID))
+	if os.IsNotExist(err) {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchKey", "Объект источника не найден")
+		return nil
+	} else if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка открытия объекта источника")
+		return nil
+	}
+	unlock()
+	if dataKey != nil {
+		decrypted, err := newDecryptReader(data, dataKey, object.Size)
+		if err != nil {
+			data.Close()
+			WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка расшифровки объекта источника")
+			return nil
+		}
+		data = decrypted
+	}
+
+	if object.VersionID != "" {
+		w.Header().Set("x-amz-copy-source-version-id", object.VersionID)
+	}
+	return &copySource{bucket: bucketName, object: object, hasVersion: hasVersion, data: data}
+}
+
+func CopyObjectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName, objectName, ok := parseObjectPath(r.URL.Path)
+	if !ok {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Неверный путь. Ожидалось /{bucketName}/{objectName}")
+		return
+	}
+
+	if !validatePresignedRequest(w, r) {
+		return
+	}
+
+	if isReservedObjectName(objectName) {
+		WriteS3Error(w, r, http.StatusForbidden, "AccessDenied", "Перезапись служебных файлов бакета запрещена")
+		return
+	}
+
+	directive := r.Header.Get("x-amz-metadata-directive")
+	if directive == "" {
+		directive = metadataDirectiveCopy
+	}
+	if directive != metadataDirectiveCopy && directive != metadataDirectiveReplace {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "x-amz-metadata-directive должен быть COPY или REPLACE")
+		return
+	}
+
+	taggingDirective := r.Header.Get("x-amz-tagging-directive")
+	if taggingDirective == "" {
+		taggingDirective = taggingDirectiveCopy
+	}
+	if taggingDirective != taggingDirectiveCopy && taggingDirective != taggingDirectiveReplace {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "x-amz-tagging-directive должен быть COPY или REPLACE")
+		return
+	}
+
+	bucket, err := Store.GetBucket(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if bucket == nil {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	encryption, ok := requestEncryption(w, r)
+	if !ok {
+		return
+	}
+
+	source := openCopySource(w, r)
+	if source == nil {
+		return
+	}
+	defer source.data.Close()
+
+	if source.bucket == bucketName && source.object.Key == objectName && !source.hasVersion &&
+		directive == metadataDirectiveCopy && taggingDirective == taggingDirectiveCopy && encryption.mode == "" && source.object.Encryption == "" {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Копирование объекта в самого себя без изменения метаданных или шифрования запрещено")
+		return
+	}
+
+	object := ObjectMetadata{Key: objectName, ContentType: source.object.ContentType, ObjectHeaders: source.object.ObjectHeaders, Tags: source.object.Tags}
+	if taggingDirective == taggingDirectiveReplace {
+		if object.Tags, ok = requestTagging(w, r); !ok {
+			return
+		}
+	}
+	if directive == metadataDirectiveReplace {
+		if object.ObjectHeaders, ok = requestObjectHeaders(w, r); !ok {
+			return
+		}
+		object.ContentType = r.Header.Get("Content-Type")
+		if object.ContentType == "" {
+			object.ContentType = "application/octet-stream"
+		}
+	}
+
+	object, err = saveObject(bucket, object, source.data, encryption, nil)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка копирования объекта")
+		return
+	}
+
+	if err := UpdateBucketStatus(bucketName); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка обновления статуса бакета")
+		return
+	}
+
+	if bucket.Versioning != "" {
+		w.Header().Set("x-amz-version-id", formatVersionID(object.VersionID))
+	}
+	setEncryptionHeaders(w, object.ObjectEncryption)
+	writeXMLResult(w, http.StatusOK, CopyObjectResult{ETag: object.ETag(), LastModified: formatS3Time(object.LastModified)})
+}
+
+// parseCopySourceRange разбирает x-amz-copy-source-range вида bytes=first-last.
+func parseCopySourceRange(value string, size int64) (int64, int64, bool) {
+	spec, found := strings.CutPrefix(value, "bytes=")
+	if !found {
+		return 0, 0, false
+	}
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start || end >= size {
+		return 0, 0, false
+	}
+	return start, end - start + 1, true
+}
+
+func UploadPartCopyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName, objectName, ok := parseObjectPath(r.URL.Path)
+	if !ok {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Неверный путь. Ожидалось /{bucketName}/{objectName}")
+		return
+	}
+
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Номер части должен быть от 1 до 10000")
+		return
+	}
+
+	upload := lookupUpload(w, r, bucketName, objectName, uploadID)
+	if upload == nil {
+		return
+	}
+	encryption, ok := uploadEncryption(w, r, upload)
+	if !ok {
+		return
+	}
+
+	source := openCopySource(w, r)
+	if source == nil {
+		return
+	}
+	defer source.data.Close()
+
+	var data io.Reader = source.data
+	if value := r.Header.Get("x-amz-copy-source-range"); value != "" {
+		start, length, ok := parseCopySourceRange(value, source.object.Size)
+		if !ok {
+			WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Некорректный заголовок x-amz-copy-source-range")
+			return
+		}
+		if _, err := source.data.Seek(start, io.SeekStart); err != nil {
+			WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения объекта источника")
+			return
+		}
+		data = io.LimitReader(source.data, length)
+	}
+
+	part, err := savePart(bucketName, uploadID, partNumber, data, nil, encryption)
+	if err != nil {
+		writePartError(w, r, err)
+		return
+	}
+
+	setEncryptionHeaders(w, ObjectEncryption{Encryption: upload.Encryption, CustomerKeyMD5: upload.CustomerKeyMD5})
+	writeXMLResult(w, http.StatusOK, CopyPartResult{ETag: part.ETag, LastModified: formatS3Time(part.LastModified)})
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import "testing"
+
+func TestParseCopySourceRange(t *testing.T) {
+	tests := []struct {
+		value         string
+		size          int64
+		start, length int64
+		ok            bool
+	}{
+		{"bytes=0-9", 100, 0, 10, true},
+		{"bytes=10-10", 100, 10, 1, true},
+		{"bytes=0-99", 100, 0, 100, true},
+		{"bytes=0-100", 100, 0, 0, false},
+		{"bytes=20-10", 100, 0, 0, false},
+		{"bytes=-10", 100, 0, 0, false},
+		{"bytes=10-", 100, 0, 0, false},
+		{"bytes=a-b", 100, 0, 0, false},
+		{"bytes=0-9,20-29", 100, 0, 0, false},
+		{"0-9", 100, 0, 0, false},
+		{"", 100, 0, 0, false},
+		{"bytes=0-0", 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, length, ok := parseCopySourceRange(tt.value, tt.size)
+		if ok != tt.ok || (ok && (start != tt.start || length != tt.length)) {
+			t.Errorf("parseCopySourceRange(%q, %d) = %d, %d, %v; ожидалось %d, %d, %v",
+				tt.value, tt.size, start, length, ok, tt.start, tt.length, tt.ok)
+		}
+	}
+}
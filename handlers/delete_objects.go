@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const maxDeleteObjects = 1000
+
+type DeleteObjectsRequest struct {
+	XMLName xml.Name           `xml:"Delete"`
+	Quiet   bool               `xml:"Quiet"`
+	Objects []ObjectIdentifier `xml:"Object"`
+}
+
+type ObjectIdentifier struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId"`
+}
+
+type DeletedObject struct {
+	Key                   string `xml:"Key"`
+	VersionID             string `xml:"VersionId,omitempty"`
+	DeleteMarker          bool   `xml:"DeleteMarker,omitempty"`
+	DeleteMarkerVersionID string `xml:"DeleteMarkerVersionId,omitempty"`
+}
+
+type DeleteError struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId,omitempty"`
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
+}
+
+type DeleteResult struct {
+	XMLName xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+	Deleted []DeletedObject `xml:"Deleted"`
+	Errors  []DeleteError   `xml:"Error"`
+}
+
+// bucketVersions — снимок версий бакета, по которому пакетное удаление находит записи
+// без повторного чтения метаданных на каждый ключ.
+type bucketVersions map[string][]ObjectMetadata
+
+func (v bucketVersions) current(key string) *ObjectMetadata {
+	versions := v[key]
+	if len(versions) == 0 || versions[0].DeleteMarker {
+		return nil
+	}
+	return &versions[0]
+}
+
+func (v bucketVersions) version(key, versionID string) *ObjectMetadata {
+	for i := range v[key] {
+		if v[key][i].VersionID == versionID {
+			return &v[key][i]
+		}
+	}
+	return nil
+}
+
+func DeleteObjectsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName := strings.Trim(r.URL.Path, "/")
+	bucket, err := Store.GetBucket(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if bucket == nil {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	expectedMD5, ok := parseContentMD5(r.Header.Get("Content-MD5"))
+	if !ok {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidDigest", "Некорректный заголовок Content-MD5")
+		return
+	}
+	body, err := io.ReadAll(&digestReader{reader: r.Body, hash: md5.New(), expected: expectedMD5})
+	if err != nil {
+		if writePayloadError(w, r, err) {
+			return
+		}
+		if errors.Is(err, errBadDigest) {
+			WriteS3Error(w, r, http.StatusBadRequest, "BadDigest", "Content-MD5 не совпадает с телом запроса")
+			return
+		}
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения тела запроса")
+		return
+	}
+
+	var request DeleteObjectsRequest
+	if err := xml.NewDecoder(bytes.NewReader(body)).Decode(&request); err != nil {
+		WriteS3Error(w, r, http.StatusBadRequest, "MalformedXML", "Некорректное тело запроса")
+		return
+	}
+	if len(request.Objects) == 0 || len(request.Objects) > maxDeleteObjects {
+		WriteS3Error(w, r, http.StatusBadRequest, "MalformedXML", "Запрос должен содержать от 1 до 1000 объектов")
+		return
+	}
+
+	keys := make([]string, len(request.Objects))
+	for i, object := range request.Objects {
+		keys[i] = object.Key
+	}
+	defer lockObjects(bucketName, keys)()
+
+	all, err := Store.ListObjectVersions(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных объектов")
+		return
+	}
+	versions := make(bucketVersions)
+	for _, version := range all {
+		versions[version.Key] = append(versions[version.Key], version)
+	}
+
+	var (
+		result  DeleteResult
+		changes []ObjectChange
+		// Содержимое удаляется только после записи метаданных, иначе сбой записи
+		// оставил бы в метаданных объекты без данных.
+		discarded []ObjectMetadata
+	)
+	fail := func(object ObjectIdentifier, code, message string) {
+		result.Errors = append(result.Errors, DeleteError{Key: object.Key, VersionID: object.VersionID, Code: code, Message: message})
+	}
+
+	for _, object := range request.Objects {
+		if object.Key == "" {
+			fail(object, "InvalidArgument", "Не указан ключ объекта")
+			continue
+		}
+		if isReservedObjectName(object.Key) {
+			fail(object, "AccessDenied", "Удаление служебных файлов бакета запрещено")
+			continue
+		}
+
+		deleted := DeletedObject{Key: object.Key, VersionID: object.VersionID}
+		switch {
+		case object.VersionID != "":
+			versionID := object.VersionID
+			if versionID == nullVersionID {
+				versionID = ""
+			}
+			// Удаление несуществующей версии, как и в S3, считается успешным.
+			version := versions.version(object.Key, versionID)
+			if version == nil {
+				break
+			}
+			changes = append(changes, ObjectChange{Object: *version, Delete: true})
+			discarded = append(discarded, *version)
+			if version.DeleteMarker {
+				deleted.DeleteMarker = true
+				deleted.DeleteMarkerVersionID = object.VersionID
+			}
+
+		case bucket.Versioning != "":
+			marker, err := newDeleteMarker(bucket, object.Key)
+			if err != nil {
+				fail(object, "InternalError", "Ошибка добавления маркера удаления")
+				continue
+			}
+			changes = append(changes, ObjectChange{Object: marker})
+			if replaced := replacedNullVersion(marker, versions.version(object.Key, "")); replaced != nil {
+				discarded = append(discarded, *replaced)
+			}
+			deleted.DeleteMarker = true
+			deleted.DeleteMarkerVersionID = formatVersionID(marker.VersionID)
+
+		default:
+			current := versions.current(object.Key)
+			if current == nil {
+				break
+			}
+			changes = append(changes, ObjectChange{Object: *current, Delete: true})
+			discarded = append(discarded, *current)
+		}
+
+		if !request.Quiet {
+			result.Deleted = append(result.Deleted, deleted)
+		}
+	}
+
+	if len(changes) > 0 {
+		if err := Store.ApplyObjectChanges(bucketName, changes); err != nil {
+			WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка обновления метаданных объектов")
+			return
+		}
+		discardVersionData(bucketName, discarded...)
+		if err := UpdateBucketStatus(bucketName); err != nil {
+			WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка обновления статуса бакета")
+			return
+		}
+	}
+
+	writeXMLResult(w, http.StatusOK, result)
+}
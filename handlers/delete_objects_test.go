@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestDeleteObjectsVersioning(t *testing.T) {
+	tests := []struct {
+		name string
+		// before включается до первой загрузки, after — до второй.
+		before, after string
+		wantVersions  int
+		wantMarker    bool
+	}{
+		{name: "без версионирования", wantVersions: 0},
+		{name: "версионирование включено", before: "Enabled", after: "Enabled", wantVersions: 3, wantMarker: true},
+		{name: "версионирование приостановлено", before: "Enabled", after: "Suspended", wantVersions: 2, wantMarker: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestStore(t)
+			mustCreateBucket(t, "batch-bucket")
+			if tt.before != "" {
+				mustSetVersioning(t, "batch-bucket", tt.before)
+			}
+			mustPutObject(t, "batch-bucket", "key", "one", nil)
+			if tt.after != "" {
+				mustSetVersioning(t, "batch-bucket", tt.after)
+			}
+			mustPutObject(t, "batch-bucket", "key", "two", nil)
+			before, err := Store.ListObjectVersions("batch-bucket")
+			if err != nil {
+				t.Fatalf("ListObjectVersions: %v", err)
+			}
+
+			body := `<Delete><Object><Key>key</Key></Object><Object><Key>missing</Key></Object></Delete>`
+			w := serve(DeleteObjectsHandler, "POST", "/batch-bucket?delete", body, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("DeleteObjects: %d %s", w.Code, w.Body)
+			}
+			var result DeleteResult
+			if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("разбор ответа: %v", err)
+			}
+			if len(result.Errors) != 0 || len(result.Deleted) != 2 || result.Deleted[0].DeleteMarker != tt.wantMarker {
+				t.Fatalf("результат: %+v", result)
+			}
+
+			// Для отсутствующего ключа версионируемый бакет тоже заводит маркер удаления.
+			after, err := Store.GetObjectVersions("batch-bucket", "key")
+			if err != nil {
+				t.Fatalf("GetObjectVersions: %v", err)
+			}
+			if len(after) != tt.wantVersions {
+				t.Fatalf("осталось версий %d, ожидалось %d: %+v", len(after), tt.wantVersions, after)
+			}
+			if tt.wantMarker && !after[0].DeleteMarker {
+				t.Errorf("актуальная версия не маркер удаления: %+v", after[0])
+			}
+
+			// Содержимое есть ровно у тех версий, что остались в метаданных.
+			for _, version := range before {
+				_, err := ObjectBackend.Stat("batch-bucket", versionDataName(version.Key, version.VersionID))
+				kept := slices.ContainsFunc(after, func(v ObjectMetadata) bool {
+					return v.VersionID == version.VersionID && !v.DeleteMarker
+				})
+				if kept != (err == nil) {
+					t.Errorf("версия %q: в метаданных %v, содержимое: %v", formatVersionID(version.VersionID), kept, err)
+				}
+			}
+
+			if w := serve(GetObjectHandler, "GET", "/batch-bucket/key", "", nil); w.Code != http.StatusNotFound {
+				t.Errorf("GET после удаления: код %d", w.Code)
+			}
+		})
+	}
+}
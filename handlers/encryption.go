@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	sseS3 = "AES256"
+	sseC  = "SSE-C"
+
+	sseKeySize   = 32
+	sseChunkSize = 64 << 10
+	sseOverhead  = 16
+
+	// Заголовки SSE-C: для самого объекта и для источника копирования.
+	sseCustomerHeaders   = "x-amz-server-side-encryption-customer-"
+	copySourceSSEHeaders = "x-amz-copy-source-server-side-encryption-customer-"
+)
+
+// masterKey шифрует ключи данных объектов SSE-S3. Загружается из файла --master-key.
+var masterKey []byte
+
+// ObjectEncryption описывает, как зашифровано содержимое версии объекта.
+// SealedKey — случайный ключ данных объекта, зашифрованный мастер-ключом или ключом клиента.
+type ObjectEncryption struct {
+	Encryption     string
+	SealedKey      string
+	CustomerKeyMD5 string
+}
+
+// LoadMasterKey читает мастер-ключ: 32 байта в base64 или в сыром виде.
+func LoadMasterKey(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать файл мастер-ключа: %v", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != sseKeySize {
+		key = data
+	}
+	if len(key) != sseKeySize {
+		return fmt.Errorf("мастер-ключ должен содержать %d байта", sseKeySize)
+	}
+	masterKey = key
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealKey(kek, dataKey []byte) (string, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, dataKey, nil)), nil
+}
+
+func openKey(kek []byte, sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("повреждён ключ данных объекта")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+// customerKey разбирает заголовки SSE-C с префиксом prefix. Если их нет, возвращает nil без ошибки.
+func customerKey(header http.Header, prefix string) ([]byte, string, error) {
+	algorithm := header.Get(prefix + "algorithm")
+	encodedKey := header.Get(prefix + "key")
+	keyMD5 := header.Get(prefix + "key-MD5")
+	if algorithm == "" && encodedKey == "" && keyMD5 == "" {
+		return nil, "", nil
+	}
+
+	if algorithm != sseS3 {
+		return nil, "", errors.New("поддерживается только алгоритм AES256")
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != sseKeySize {
+		return nil, "", errors.New("ключ клиента должен содержать 256 бит в base64")
+	}
+	sum := md5.Sum(key)
+	expected := base64.StdEncoding.EncodeToString(sum[:])
+	if keyMD5 != expected {
+		return nil, "", errors.New("MD5 ключа клиента не совпадает")
+	}
+	return key, expected, nil
+}
+
+type encryptionRequest struct {
+	mode           string
+	kek            []byte
+	customerKeyMD5 string
+}
+
+// requestEncryption определяет режим шифрования загружаемого объекта.
+// При ошибке пишет ответ сам и возвращает false.
+func requestEncryption(w http.ResponseWriter, r *http.Request) (*encryptionRequest, bool) {
+	key, keyMD5, err := customerKey(r.Header, sseCustomerHeaders)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return nil, false
+	}
+
+	mode := r.Header.Get("x-amz-server-side-encryption")
+	switch {
+	case mode != "" && key != nil:
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Нельзя одновременно использовать SSE-S3 и SSE-C")
+		return nil, false
+	case mode != "" && mode != sseS3:
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Поддерживается только x-amz-server-side-encryption: AES256")
+		return nil, false
+	case mode == sseS3 && masterKey == nil:
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "SSE-S3 недоступно: сервер запущен без --master-key")
+		return nil, false
+	case mode == sseS3:
+		return &encryptionRequest{mode: sseS3, kek: masterKey}, true
+	case key != nil:
+		return &encryptionRequest{mode: sseC, kek: key, customerKeyMD5: keyMD5}, true
+	}
+	return &encryptionRequest{}, true
+}
+
+// encrypt оборачивает открытые данные шифрующим потоком со свежим ключом данных.
+func (e *encryptionRequest) encrypt(r io.Reader) (io.Reader, ObjectEncryption, error) {
+	if e.mode == "" {
+		return r, ObjectEncryption{}, nil
+	}
+
+	dataKey := make([]byte, sseKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, ObjectEncryption{}, err
+	}
+	sealed, err := sealKey(e.kek, dataKey)
+	if err != nil {
+		return nil, ObjectEncryption{}, err
+	}
+	reader, err := newEncryptReader(r, dataKey)
+	if err != nil {
+		return nil, ObjectEncryption{}, err
+	}
+	return reader, ObjectEncryption{Encryption: e.mode, SealedKey: sealed, CustomerKeyMD5: e.customerKeyMD5}, nil
+}
+
+// objectDataKey достаёт ключ данных для чтения объекта. Для незашифрованного объекта
+// возвращает nil. При ошибке пишет ответ сам и возвращает false.
+func objectDataKey(w http.ResponseWriter, r *http.Request, object *ObjectMetadata) ([]byte, bool) {
+	return openDataKey(w, r, object, sseCustomerHeaders)
+}
+
+// openDataKey — то же, что objectDataKey, но ключ клиента берётся из заголовков с префиксом prefix.
+func openDataKey(w http.ResponseWriter, r *http.Request, object *ObjectMetadata, prefix string) ([]byte, bool) {
+	key, keyMD5, err := customerKey(r.Header, prefix)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return nil, false
+	}
+
+	switch object.Encryption {
+	case "":
+		if key != nil {
+			WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Объект не зашифрован ключом клиента")
+			return nil, false
+		}
+		return nil, true
+	case sseS3:
+		if masterKey == nil {
+			WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Объект зашифрован SSE-S3, но мастер-ключ не загружен")
+			return nil, false
+		}
+		dataKey, err := openKey(masterKey, object.SealedKey)
+		if err != nil {
+			WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Не удалось расшифровать ключ данных объекта")
+			return nil, false
+		}
+		return dataKey, true
+	case sseC:
+		if key == nil {
+			WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Объект зашифрован ключом клиента, укажите заголовки SSE-C")
+			return nil, false
+		}
+		if subtle.ConstantTimeCompare([]byte(keyMD5), []byte(object.CustomerKeyMD5)) != 1 {
+			WriteS3Error(w, r, http.StatusForbidden, "AccessDenied", "Ключ клиента не подходит к объекту")
+			return nil, false
+		}
+		dataKey, err := openKey(key, object.SealedKey)
+		if err != nil {
+			WriteS3Error(w, r, http.StatusForbidden, "AccessDenied", "Ключ клиента не подходит к объекту")
+			return nil, false
+		}
+		return dataKey, true
+	default:
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Неизвестный режим шифрования объекта")
+		return nil, false
+	}
+}
+
+func setEncryptionHeaders(w http.ResponseWriter, encryption ObjectEncryption) {
+	switch encryption.Encryption {
+	case sseS3:
+		w.Header().Set("x-amz-server-side-encryption", sseS3)
+	case sseC:
+		w.Header().Set("x-amz-server-side-encryption-customer-algorithm", sseS3)
+		w.Header().Set("x-amz-server-side-encryption-customer-key-MD5", encryption.CustomerKeyMD5)
+	}
+}
+
+// Содержимое шифруется блоками по sseChunkSize в AES-GCM, чтобы поток можно было
+// расшифровывать с любого места. Номер блока и признак последнего блока входят в nonce,
+// поэтому блоки нельзя переставить или отрезать незаметно.
+func chunkNonce(index int64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, uint64(index))
+	if final {
+		nonce[8] = 1
+	}
+	return nonce
+}
+
+// encryptedSize — размер зашифрованного содержимого: к каждому блоку, в том числе
+// к единственному пустому блоку пустого объекта, добавляется тег GCM.
+func encryptedSize(size int64) int64 {
+	chunks := (size + sseChunkSize - 1) / sseChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return size + chunks*sseOverhead
+}
+
+type encryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	plain   []byte
+	pending []byte
+	index   int64
+	done    bool
+}
+
+func newEncryptReader(r io.Reader, dataKey []byte) (*encryptReader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptReader{
+		src:   bufio.NewReaderSize(r, sseChunkSize),
+		aead:  aead,
+		plain: make([]byte, sseChunkSize),
+	}, nil
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for len(e.pending) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.sealChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+func (e *encryptReader) sealChunk() error {
+	n, err := io.ReadFull(e.src, e.plain)
+	final := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !final {
+		return err
+	}
+	if !final {
+		if _, err := e.src.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	e.pending = e.aead.Seal(e.pending[:0], chunkNonce(e.index, final), e.plain[:n], nil)
+	e.index++
+	e.done = final
+	return nil
+}
+
+// decryptReader расшифровывает объект и поддерживает Seek по открытому тексту,
+// поэтому с ним работают Range-запросы в http.ServeContent.
+type decryptReader struct {
+	src    io.ReadSeekCloser
+	aead   cipher.AEAD
+	size   int64
+	offset int64
+	chunk  []byte
+	loaded int64
+}
+
+func newDecryptReader(src io.ReadSeekCloser, dataKey []byte, size int64) (*decryptReader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{src: src, aead: aead, size: size, loaded: -1}, nil
+}
+
+func (d *decryptReader) loadChunk(index int64) error {
+	if index == d.loaded {
+		return nil
+	}
+
+	plainLen := d.size - index*sseChunkSize
+	if plainLen > sseChunkSize {
+		plainLen = sseChunkSize
+	}
+	if _, err := d.src.Seek(index*(sseChunkSize+sseOverhead), io.SeekStart); err != nil {
+		return err
+	}
+	sealed := make([]byte, plainLen+sseOverhead)
+	if _, err := io.ReadFull(d.src, sealed); err != nil {
+		return fmt.Errorf("содержимое объекта обрезано: %v", err)
+	}
+
+	final := index == (d.size-1)/sseChunkSize
+	chunk, err := d.aead.Open(sealed[:0], chunkNonce(index, final), sealed, nil)
+	if err != nil {
+		return errors.New("содержимое объекта повреждено")
+	}
+	d.chunk = chunk
+	d.loaded = index
+	return nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	if d.offset >= d.size {
+		return 0, io.EOF
+	}
+
+	index := d.offset / sseChunkSize
+	if err := d.loadChunk(index); err != nil {
+		return 0, err
+	}
+	n := copy(p, d.chunk[d.offset-index*sseChunkSize:])
+	d.offset += int64(n)
+	return n, nil
+}
+
+func (d *decryptReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.offset
+	case io.SeekEnd:
+		offset += d.size
+	default:
+		return 0, errors.New("некорректный whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("отрицательное смещение")
+	}
+	d.offset = offset
+	return offset, nil
+}
+
+func (d *decryptReader) Close() error {
+	return d.src.Close()
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func customerKeyHeaders(key string) http.Header {
+	sum := md5.Sum([]byte(key))
+	header := http.Header{}
+	header.Set(sseCustomerHeaders+"algorithm", sseS3)
+	header.Set(sseCustomerHeaders+"key", base64.StdEncoding.EncodeToString([]byte(key)))
+	header.Set(sseCustomerHeaders+"key-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	return header
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "sse-bucket")
+
+	// Содержимое длиннее двух блоков шифрования, последний блок неполный.
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 2*sseChunkSize+1000; i++ {
+		buf.WriteString(strings.Repeat(string(rune('a'+i%26)), 97))
+	}
+	content := buf.String()
+	size := int64(len(content))
+
+	sseS3Header := http.Header{}
+	sseS3Header.Set("x-amz-server-side-encryption", sseS3)
+	customer := customerKeyHeaders("0123456789abcdef0123456789abcdef")
+
+	tests := []struct {
+		name       string
+		putHeader  http.Header
+		getHeader  http.Header
+		encryption string
+	}{
+		{"без шифрования", nil, nil, ""},
+		{"SSE-S3", sseS3Header, nil, sseS3},
+		{"SSE-C", customer, customer, sseC},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objectName := "object-" + strings.ToLower(strings.ReplaceAll(tt.name, " ", "-"))
+			mustPutObject(t, "sse-bucket", objectName, content, tt.putHeader)
+
+			object, err := Store.GetObject("sse-bucket", objectName)
+			if err != nil || object == nil {
+				t.Fatalf("метаданные объекта: %v %v", object, err)
+			}
+			if object.Encryption != tt.encryption || object.Size != size {
+				t.Fatalf("Encryption=%q Size=%d, ожидалось %q и %d", object.Encryption, object.Size, tt.encryption, size)
+			}
+			info, err := ObjectBackend.Stat("sse-bucket", objectName)
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			wantStored := size
+			if tt.encryption != "" {
+				wantStored = encryptedSize(size)
+			}
+			if info.Size != wantStored {
+				t.Errorf("в хранилище %d байт, ожидалось %d", info.Size, wantStored)
+			}
+
+			w := serve(GetObjectHandler, "GET", "/sse-bucket/"+objectName, "", tt.getHeader)
+			if w.Code != http.StatusOK || w.Body.String() != content {
+				t.Fatalf("GET: %d, совпадает: %v", w.Code, w.Body.String() == content)
+			}
+
+			ranges := []struct {
+				header string
+				want   string
+			}{
+				{"bytes=0-9", content[:10]},
+				{"bytes=65530-65545", content[65530:65546]},
+				{"bytes=-10", content[size-10:]},
+				{"bytes=131000-", content[131000:]},
+			}
+			getRange := func(value string) *httptest.ResponseRecorder {
+				header := http.Header{"Range": {value}}
+				for name, values := range tt.getHeader {
+					header[name] = values
+				}
+				return serve(GetObjectHandler, "GET", "/sse-bucket/"+objectName, "", header)
+			}
+			for _, rg := range ranges {
+				w := getRange(rg.header)
+				if w.Code != http.StatusPartialContent || w.Body.String() != rg.want {
+					t.Errorf("Range %s: код %d, длина %d, ожидалась %d", rg.header, w.Code, w.Body.Len(), len(rg.want))
+				}
+			}
+			if w := getRange("bytes=999999-"); w.Code != http.StatusRequestedRangeNotSatisfiable {
+				t.Errorf("Range за концом объекта: код %d", w.Code)
+			}
+		})
+	}
+
+	t.Run("SSE-C без ключа и с чужим ключом", func(t *testing.T) {
+		objectName := "object-sse-c"
+		if w := serve(GetObjectHandler, "GET", "/sse-bucket/"+objectName, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("без ключа: код %d", w.Code)
+		}
+		other := customerKeyHeaders("fedcba9876543210fedcba9876543210")
+		if w := serve(GetObjectHandler, "GET", "/sse-bucket/"+objectName, "", other); w.Code != http.StatusForbidden {
+			t.Errorf("с чужим ключом: код %d", w.Code)
+		}
+	})
+}
+
+func TestEncryptedSize(t *testing.T) {
+	tests := []struct {
+		plain, want int64
+	}{
+		{0, sseOverhead},
+		{1, 1 + sseOverhead},
+		{sseChunkSize, sseChunkSize + sseOverhead},
+		{sseChunkSize + 1, sseChunkSize + 1 + 2*sseOverhead},
+		{3 * sseChunkSize, 3 * (sseChunkSize + sseOverhead)},
+	}
+	for _, tt := range tests {
+		if got := encryptedSize(tt.plain); got != tt.want {
+			t.Errorf("encryptedSize(%d) = %d, ожидалось %d", tt.plain, got, tt.want)
+		}
+	}
+}
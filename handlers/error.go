@@ -1,19 +1,42 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/xml"
 	"net/http"
+	"strings"
 )
 
-type XMLResponse struct {
-	XMLName xml.Name `xml:"Response"`
-	Code    string   `xml:"Code"`
-	Message string   `xml:"Message"`
+// S3Error — документ ошибки в формате S3.
+type S3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
 }
 
-func WriteXMLResponse(w http.ResponseWriter, statusCode int, code string, message string) {
+// SetRequestID выдаёт запросу идентификатор и возвращает его в заголовке x-amz-request-id.
+func SetRequestID(w http.ResponseWriter) string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	requestID := strings.ToUpper(hex.EncodeToString(buf))
+	w.Header().Set("x-amz-request-id", requestID)
+	return requestID
+}
+
+func WriteS3Error(w http.ResponseWriter, r *http.Request, statusCode int, code string, message string) {
 	w.Header().Set("Content-Type", "application/xml")
 	w.WriteHeader(statusCode)
-	errorResponse := XMLResponse{Code: code, Message: message}
-	xml.NewEncoder(w).Encode(errorResponse)
+	if r.Method == "HEAD" {
+		return
+	}
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(S3Error{
+		Code:      code,
+		Message:   message,
+		Resource:  r.URL.Path,
+		RequestID: w.Header().Get("x-amz-request-id"),
+	})
 }
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWriteS3Error(t *testing.T) {
+	w := httptest.NewRecorder()
+	requestID := SetRequestID(w)
+	if !regexp.MustCompile(`^[0-9A-F]{16}$`).MatchString(requestID) {
+		t.Fatalf("идентификатор запроса %q", requestID)
+	}
+	if other := SetRequestID(httptest.NewRecorder()); other == requestID {
+		t.Errorf("идентификаторы запросов повторяются: %s", other)
+	}
+
+	r := httptest.NewRequest("GET", "/my-bucket/key", nil)
+	WriteS3Error(w, r, http.StatusNotFound, "NoSuchKey", "Объект не найден")
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/xml" {
+		t.Fatalf("код %d, Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.HasPrefix(w.Body.String(), xml.Header) {
+		t.Errorf("нет XML-заголовка: %s", w.Body)
+	}
+	var s3Err S3Error
+	if err := xml.Unmarshal(w.Body.Bytes(), &s3Err); err != nil {
+		t.Fatalf("разбор ответа: %v", err)
+	}
+	want := S3Error{XMLName: xml.Name{Local: "Error"}, Code: "NoSuchKey", Message: "Объект не найден", Resource: "/my-bucket/key", RequestID: requestID}
+	if s3Err != want {
+		t.Errorf("получено %+v, ожидалось %+v", s3Err, want)
+	}
+
+	w = httptest.NewRecorder()
+	WriteS3Error(w, httptest.NewRequest("HEAD", "/my-bucket/key", nil), http.StatusNotFound, "NoSuchKey", "Объект не найден")
+	if w.Code != http.StatusNotFound || w.Body.Len() != 0 {
+		t.Errorf("HEAD: код %d, тело %q", w.Code, w.Body)
+	}
+}
+
+func TestHandlerErrorCodes(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "errors-bucket")
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		method   string
+		target   string
+		wantCode int
+		wantErr  string
+	}{
+		{"бакета нет", GetObjectHandler, "GET", "/missing-bucket/key", http.StatusNotFound, "NoSuchBucket"},
+		{"объекта нет", GetObjectHandler, "GET", "/errors-bucket/key", http.StatusNotFound, "NoSuchKey"},
+		{"версии нет", GetObjectHandler, "GET", "/errors-bucket/key?versionId=v1", http.StatusNotFound, "NoSuchVersion"},
+		{"служебный файл", GetObjectHandler, "GET", "/errors-bucket/" + systemDirName + "/lifecycle.xml", http.StatusForbidden, "AccessDenied"},
+		{"неверный метод", GetObjectHandler, "POST", "/errors-bucket/key", http.StatusMethodNotAllowed, "MethodNotAllowed"},
+		{"бакет уже есть", CreateBucketHandler, "PUT", "/errors-bucket", http.StatusConflict, "BucketAlreadyOwnedByYou"},
+		{"неверное имя бакета", CreateBucketHandler, "PUT", "/Bad_Name", http.StatusBadRequest, "InvalidBucketName"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.handler, tt.method, tt.target, "", nil)
+			var s3Err S3Error
+			if w.Code != tt.wantCode || xml.Unmarshal(w.Body.Bytes(), &s3Err) != nil || s3Err.Code != tt.wantErr {
+				t.Errorf("код %d, тело %s; ожидалось %d %s", w.Code, w.Body, tt.wantCode, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"crypto/md5"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FsckReport подводит итог проверки: сколько проблем найдено и сколько из них исправлено.
+type FsckReport struct {
+	Problems int
+	Repaired int
+}
+
+type fsckChecker struct {
+	baseDir string
+	csv     *CSVStore
+	repair  bool
+	out     io.Writer
+	report  FsckReport
+}
+
+// Fsck сверяет метаданные бакетов, метаданные объектов и файлы в baseDir: находит повторяющиеся
+// и повреждённые строки objects.csv, записи без файлов, файлы без записей, несовпадение размеров
+// и директории бакетов без метаданных. С repair исправляет то, что можно восстановить по файлам.
+// Store и ObjectBackend должны быть открыты над baseDir, сервер при этом работать не должен.
+func Fsck(baseDir string, repair bool, out io.Writer) (FsckReport, error) {
+	c := &fsckChecker{baseDir: baseDir, repair: repair, out: out}
+	c.csv, _ = Store.(*CSVStore)
+
+	if repair {
+		if err := RecoverDataDir(baseDir); err != nil {
+			return c.report, err
+		}
+	}
+
+	buckets, err := Store.ListBuckets()
+	if err != nil {
+		return c.report, err
+	}
+	known := make(map[string]bool, len(buckets))
+	for _, bucket := range buckets {
+		known[bucket.Name] = true
+	}
+
+	for i := range buckets {
+		if err := c.checkBucket(&buckets[i], true); err != nil {
+			return c.report, err
+		}
+	}
+
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return c.report, fmt.Errorf("не удалось прочитать директорию данных: %v", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || known[entry.Name()] {
+			continue
+		}
+		if err := c.checkUnknownDir(entry); err != nil {
+			return c.report, err
+		}
+	}
+	return c.report, nil
+}
+
+// problem печатает найденную проблему. fix вызывается только в режиме исправления;
+// если он вернул false, проблема считается неисправленной.
+func (c *fsckChecker) problem(subject, message string, fix func() (bool, error)) error {
+	c.report.Problems++
+	repaired := false
+	if c.repair && fix != nil {
+		ok, err := fix()
+		if err != nil {
+			return fmt.Errorf("%s: %v", subject, err)
+		}
+		repaired = ok
+	}
+
+	if repaired {
+		c.report.Repaired++
+		fmt.Fprintf(c.out, "%s: %s [исправлено]\n", subject, message)
+	} else {
+		fmt.Fprintf(c.out, "%s: %s\n", subject, message)
+	}
+	return nil
+}
+
+// checkUnknownDir разбирает директорию, которой нет в метаданных бакетов. Если её имя
+// годится для бакета, при исправлении бакет добавляется в метаданные вместе с файлами.
+func (c *fsckChecker) checkUnknownDir(entry os.DirEntry) error {
+	name := entry.Name()
+	if !isValidBucketName(name) {
+		return c.problem(name, "директория не является бакетом и не найдена в метаданных", nil)
+	}
+
+	var bucket *BucketMetadata
+	err := c.problem(name, "директория не найдена в метаданных бакетов", func() (bool, error) {
+		info, err := entry.Info()
+		if err != nil {
+			return false, err
+		}
+		created := info.ModTime().UTC().Format(time.RFC3339)
+		bucket = &BucketMetadata{Name: name, CreationTime: created, LastModified: created, Status: "Inactive"}
+		return true, Store.PutBucket(*bucket)
+	})
+	if err != nil || bucket == nil {
+		return err
+	}
+	return c.checkBucket(bucket, false)
+}
+
+// checkBucket сверяет метаданные бакета с файлами. complete означает, что записи объектов
+// прочитаны из хранилища целиком; только тогда содержимое версий без записей можно удалять.
+func (c *fsckChecker) checkBucket(bucket *BucketMetadata, complete bool) error {
+	bucketDir := filepath.Join(c.baseDir, bucket.Name)
+	if _, err := os.Stat(bucketDir); os.IsNotExist(err) {
+		err := c.problem(bucket.Name, "директория бакета отсутствует", func() (bool, error) {
+			return true, ObjectBackend.MakeBucket(bucket.Name)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.csv != nil {
+		intact, err := c.checkObjectsCSV(bucket.Name)
+		if err != nil {
+			return err
+		}
+		complete = complete && intact
+	}
+
+	versions, err := Store.ListObjectVersions(bucket.Name)
+	if err != nil {
+		return c.problem(bucket.Name, fmt.Sprintf("метаданные объектов не читаются: %v", err), nil)
+	}
+
+	referenced := make(map[string]bool)
+	hasVersions := make(map[string]bool)
+	var removed []ObjectChange
+	for _, version := range versions {
+		hasVersions[version.Key] = true
+		if version.DeleteMarker {
+			continue
+		}
+		if err := c.checkVersionData(bucket.Name, version, referenced, &removed); err != nil {
+			return err
+		}
+	}
+
+	var added []ObjectChange
+	err = ObjectBackend.List(bucket.Name, func(info ObjectInfo) error {
+		if referenced[info.Key] {
+			return nil
+		}
+		subject := bucket.Name + "/" + info.Key
+		if hasVersions[info.Key] {
+			return c.problem(subject, "файл не учтён в метаданных, а у ключа есть другие версии", nil)
+		}
+		return c.problem(subject, "файл не учтён в метаданных", func() (bool, error) {
+			object, err := objectFromFile(bucket.Name, info)
+			if err != nil {
+				return false, err
+			}
+			added = append(added, ObjectChange{Object: object})
+			return true, nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("не удалось обойти файлы бакета %s: %v", bucket.Name, err)
+	}
+
+	if err := c.checkVersionsDir(bucket.Name, referenced, complete); err != nil {
+		return err
+	}
+
+	if changes := append(removed, added...); len(changes) > 0 {
+		if err := Store.ApplyObjectChanges(bucket.Name, changes); err != nil {
+			return err
+		}
+	}
+	return c.checkBucketStatus(bucket)
+}
+
+// checkObjectsCSV ищет в objects.csv строки, которые сервер при чтении молча отбрасывает
+// или перекрывает. При исправлении файл переписывается так, как его прочитал бы сервер.
+// Возвращает false, если файла нет или какие-то строки не прочитались.
+func (c *fsckChecker) checkObjectsCSV(bucketName string) (bool, error) {
+	path := filepath.Join(c.baseDir, bucketName, "objects.csv")
+	subject := bucketName + "/objects.csv"
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, c.problem(subject, "файл отсутствует", func() (bool, error) {
+			return true, c.csv.writeObjects(bucketName, newObjectIndex())
+		})
+	} else if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	idx := newObjectIndex()
+	counts := make(map[ObjectIdentifier]int)
+	var order []ObjectIdentifier
+	intact := true
+
+	// Все проблемы строк исправляются одной перезаписью файла в конце.
+	rewrite := false
+	dropRow := func() (bool, error) {
+		rewrite = true
+		return true, nil
+	}
+
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			intact = false
+			c.problem(subject, fmt.Sprintf("строка %d повреждена: %v", parseErr.Line, parseErr.Err), dropRow)
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		if first {
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(record) < 4 {
+			intact = false
+			c.problem(subject, fmt.Sprintf("строка %d содержит %d колонок, нужно не меньше 4", line, len(record)), dropRow)
+			continue
+		}
+		object, err := recordToObject(record)
+		if err != nil {
+			intact = false
+			c.problem(subject, fmt.Sprintf("строка %d: %v", line, err), dropRow)
+			continue
+		}
+
+		id := ObjectIdentifier{Key: object.Key, VersionID: object.VersionID}
+		if counts[id] == 0 {
+			order = append(order, id)
+		}
+		counts[id]++
+		idx.put(object)
+	}
+
+	for _, id := range order {
+		if counts[id] > 1 {
+			c.problem(versionSubject(bucketName, id.Key, id.VersionID), fmt.Sprintf("запись повторяется в objects.csv %d раз", counts[id]), dropRow)
+		}
+	}
+	if !rewrite {
+		return intact, nil
+	}
+	return intact, c.csv.writeObjects(bucketName, idx)
+}
+
+// checkVersionData сверяет запись версии с её файлом. Запись без файла удаляется,
+// размер незашифрованного объекта пересчитывается по файлу вместе с ETag.
+func (c *fsckChecker) checkVersionData(bucketName string, version ObjectMetadata, referenced map[string]bool, removed *[]ObjectChange) error {
+	dataName := versionDataName(version.Key, version.VersionID)
+	referenced[dataName] = true
+	subject := versionSubject(bucketName, version.Key, version.VersionID)
+
+	info, err := ObjectBackend.Stat(bucketName, dataName)
+	if os.IsNotExist(err) {
+		return c.problem(subject, "файл отсутствует", func() (bool, error) {
+			*removed = append(*removed, ObjectChange{Object: version, Delete: true})
+			return true, nil
+		})
+	} else if err != nil {
+		return err
+	}
+
+	expected := version.Size
+	if version.Encryption != "" {
+		expected = encryptedSize(version.Size)
+	}
+	if info.Size == expected {
+		return nil
+	}
+
+	message := fmt.Sprintf("размер файла %d, в метаданных %d", info.Size, expected)
+	if version.Encryption != "" {
+		return c.problem(subject, message+"; размер зашифрованного объекта по файлу не восстановить", nil)
+	}
+	return c.problem(subject, message, func() (bool, error) {
+		etag, err := fileMD5(bucketName, dataName)
+		if err != nil {
+			return false, err
+		}
+		version.Size = info.Size
+		version.StoredETag = etag
+		return true, Store.UpdateObject(bucketName, version)
+	})
+}
+
+// checkVersionsDir ищет содержимое версий, на которое не ссылается ни одна запись.
+// Ключ такой версии неизвестен, поэтому восстановить её нельзя и при исправлении она удаляется,
+// но только если записи прочитаны целиком: иначе это может быть версия из потерянной записи.
+func (c *fsckChecker) checkVersionsDir(bucketName string, referenced map[string]bool, complete bool) error {
+	entries, err := os.ReadDir(filepath.Join(c.baseDir, bucketName, systemDirName, "versions"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		dataName := systemDirName + "/versions/" + entry.Name()
+		if entry.IsDir() || referenced[dataName] {
+			continue
+		}
+		subject := bucketName + "/" + dataName
+		if !complete {
+			if err := c.problem(subject, "содержимое версии не принадлежит ни одной записи; метаданные бакета неполные, файл оставлен", nil); err != nil {
+				return err
+			}
+			continue
+		}
+		err := c.problem(subject, "содержимое версии не принадлежит ни одному объекту", func() (bool, error) {
+			return true, ObjectBackend.Delete(bucketName, dataName)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *fsckChecker) checkBucketStatus(bucket *BucketMetadata) error {
+	empty, err := isBucketEmpty(bucket.Name)
+	if err != nil {
+		return err
+	}
+	expected := "Active"
+	if empty {
+		expected = "Inactive"
+	}
+	if current, err := Store.GetBucket(bucket.Name); err != nil {
+		return err
+	} else if current != nil && current.Status == expected {
+		return nil
+	}
+
+	return c.problem(bucket.Name, fmt.Sprintf("статус бакета должен быть %s", expected), func() (bool, error) {
+		return true, UpdateBucketStatus(bucket.Name)
+	})
+}
+
+func versionSubject(bucketName, objectName, versionID string) string {
+	if versionID == "" {
+		return bucketName + "/" + objectName
+	}
+	return fmt.Sprintf("%s/%s (версия %s)", bucketName, objectName, versionID)
+}
+
+// objectFromFile строит запись null-версии для файла, которого нет в метаданных.
+func objectFromFile(bucketName string, info ObjectInfo) (ObjectMetadata, error) {
+	etag, err := fileMD5(bucketName, info.Key)
+	if err != nil {
+		return ObjectMetadata{}, err
+	}
+	return ObjectMetadata{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  "application/octet-stream",
+		LastModified: info.ModTime.UTC().Format(time.RFC3339),
+		StoredETag:   etag,
+	}, nil
+}
+
+func fileMD5(bucketName, dataName string) (string, error) {
+	data, err := ObjectBackend.Get(bucketName, dataName)
+	if err != nil {
+		return "", err
+	}
+	defer data.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, data); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runFsck(t *testing.T, repair bool) (FsckReport, string) {
+	t.Helper()
+	var out bytes.Buffer
+	report, err := Fsck(BaseDir, repair, &out)
+	if err != nil {
+		t.Fatalf("Fsck(repair=%v): %v\n%s", repair, err, out.String())
+	}
+	return report, out.String()
+}
+
+func TestFsckCleanDataDir(t *testing.T) {
+	setupFSRecovery(t)
+	mustPutObject(t, "crash-bucket", "key", "x", nil)
+	mustCreateBucket(t, "empty-bucket")
+
+	if report, out := runFsck(t, false); report.Problems != 0 {
+		t.Errorf("в исправных данных найдены проблемы:\n%s", out)
+	}
+}
+
+func TestFsckRepair(t *testing.T) {
+	setupFSRecovery(t)
+	mustPutObject(t, "crash-bucket", "lost", "lost", nil)
+	mustPutObject(t, "crash-bucket", "resized", "short", nil)
+	mustPutObject(t, "crash-bucket", "dup", "dup", nil)
+
+	bucketDir := filepath.Join(BaseDir, "crash-bucket")
+	write := func(path, data string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Remove(filepath.Join(bucketDir, "lost"))
+	write(filepath.Join(bucketDir, "resized"), "much longer")
+	write(filepath.Join(bucketDir, "untracked"), "untracked")
+	write(filepath.Join(bucketDir, systemDirName, "versions", "orphan"), "orphan")
+	write(filepath.Join(BaseDir, "found-bucket", "file"), "found")
+
+	csvPath := filepath.Join(bucketDir, "objects.csv")
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "dup,") {
+			write(csvPath, string(data)+line)
+		}
+	}
+
+	wantSubjects := []string{
+		"crash-bucket/lost: файл отсутствует",
+		"crash-bucket/resized: размер файла 11, в метаданных 5",
+		"crash-bucket/untracked: файл не учтён в метаданных",
+		"crash-bucket/" + systemDirName + "/versions/orphan: содержимое версии не принадлежит ни одному объекту",
+		"crash-bucket/dup: запись повторяется в objects.csv 2 раз",
+		"found-bucket: директория не найдена в метаданных бакетов",
+	}
+	report, out := runFsck(t, false)
+	if report.Repaired != 0 || report.Problems != len(wantSubjects) {
+		t.Errorf("проверка: %+v\n%s", report, out)
+	}
+	for _, subject := range wantSubjects {
+		if !strings.Contains(out, subject+"\n") {
+			t.Errorf("не найдено %q в\n%s", subject, out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(bucketDir, systemDirName, "versions", "orphan")); err != nil {
+		t.Errorf("проверка без --repair изменила данные: %v", err)
+	}
+
+	report, out = runFsck(t, true)
+	if report.Problems == 0 || report.Repaired != report.Problems {
+		t.Errorf("исправление: %+v\n%s", report, out)
+	}
+	if report, out := runFsck(t, false); report.Problems != 0 {
+		t.Errorf("после исправления остались проблемы:\n%s", out)
+	}
+
+	checks := []struct {
+		target   string
+		wantCode int
+		wantBody string
+	}{
+		{"/crash-bucket/lost", http.StatusNotFound, ""},
+		{"/crash-bucket/resized", http.StatusOK, "much longer"},
+		{"/crash-bucket/untracked", http.StatusOK, "untracked"},
+		{"/crash-bucket/dup", http.StatusOK, "dup"},
+		{"/found-bucket/file", http.StatusOK, "found"},
+	}
+	for _, check := range checks {
+		w := serve(GetObjectHandler, "GET", check.target, "", nil)
+		if w.Code != check.wantCode || (check.wantBody != "" && w.Body.String() != check.wantBody) {
+			t.Errorf("%s: код %d, тело %q", check.target, w.Code, w.Body)
+			continue
+		}
+		if w.Code == http.StatusOK {
+			sum := md5.Sum(w.Body.Bytes())
+			if etag := `"` + hex.EncodeToString(sum[:]) + `"`; w.Header().Get("ETag") != etag {
+				t.Errorf("%s: ETag %s, ожидалось %s", check.target, w.Header().Get("ETag"), etag)
+			}
+		}
+	}
+}
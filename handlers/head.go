@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func HeadBucketHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "HEAD" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	bucketName := strings.Trim(r.URL.Path, "/")
+
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func HeadObjectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "HEAD" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	pathSegments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(pathSegments) < 2 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	bucketName := pathSegments[0]
+	objectName := strings.Join(pathSegments[1:], "/")
+
+	if isReservedObjectName(objectName) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	metadata, err := getRequestedObject(r, bucketName, objectName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if metadata == nil {
+		if _, ok := versionIDParam(r); !ok {
+			setLatestDeleteMarkerHeaders(w, bucketName, objectName)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if metadata.DeleteMarker {
+		w.Header().Set("x-amz-delete-marker", "true")
+		w.Header().Set("x-amz-version-id", formatVersionID(metadata.VersionID))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := objectDataKey(w, r, metadata); !ok {
+		return
+	}
+	if _, err := ObjectBackend.Stat(bucketName, versionDataName(objectName, metadata.VersionID)); os.IsNotExist(err) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", metadata.ContentType)
+	w.Header().Set("ETag", metadata.ETag())
+	w.Header().Set("Accept-Ranges", "bytes")
+	if metadata.VersionID != "" {
+		w.Header().Set("x-amz-version-id", metadata.VersionID)
+	}
+	setEncryptionHeaders(w, metadata.ObjectEncryption)
+	setObjectHeaders(w, metadata.ObjectHeaders)
+	setTaggingCountHeader(w, metadata.Tags)
+
+	// Условные заголовки и Range проверяются так же, как в GET. Тело HEAD не читается,
+	// поэтому ServeContent достаточно пустого содержимого нужного размера.
+	http.ServeContent(w, r, "", metadata.LastModifiedTime(), io.NewSectionReader(strings.NewReader(""), 0, metadata.Size))
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHeadObjectConditions(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "head-bucket")
+	etag := mustPutObject(t, "head-bucket", "key", "hello", nil).Header().Get("ETag")
+
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"без условий", nil, http.StatusOK},
+		{"If-Match совпал", http.Header{"If-Match": {etag}}, http.StatusOK},
+		{"If-Match не совпал", http.Header{"If-Match": {`"other"`}}, http.StatusPreconditionFailed},
+		{"If-None-Match совпал", http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{"If-Modified-Since в будущем", http.Header{"If-Modified-Since": {future}}, http.StatusNotModified},
+		{"If-Modified-Since в прошлом", http.Header{"If-Modified-Since": {past}}, http.StatusOK},
+		{"If-Unmodified-Since в прошлом", http.Header{"If-Unmodified-Since": {past}}, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head := serve(HeadObjectHandler, "HEAD", "/head-bucket/key", "", tt.header)
+			get := serve(GetObjectHandler, "GET", "/head-bucket/key", "", tt.header)
+			if head.Code != tt.want || get.Code != tt.want {
+				t.Fatalf("HEAD %d, GET %d, ожидалось %d", head.Code, get.Code, tt.want)
+			}
+			if head.Code == http.StatusOK {
+				if head.Header().Get("Content-Length") != "5" || head.Header().Get("Accept-Ranges") != "bytes" || head.Body.Len() != 0 {
+					t.Errorf("HEAD: заголовки %v, тело %q", head.Header(), head.Body)
+				}
+			}
+		})
+	}
+}
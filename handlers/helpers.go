@@ -1,6 +1,10 @@
 package handlers
 
-import "strings"
+import (
+	"net"
+	"net/http"
+	"strings"
+)
 
 func ParseURLPath(path string) []string {
 	trimmed := strings.Trim(path, "/")
@@ -10,6 +14,50 @@ func ParseURLPath(path string) []string {
 	return strings.Split(trimmed, "/")
 }
 
+// BaseDomain включает virtual-hosted адресацию: запрос к {bucket}.BaseDomain
+// обращается к бакету bucket. Пустое значение оставляет только path-style.
+var BaseDomain string
+
+// bucketFromHost возвращает имя бакета из Host вида {bucket}.BaseDomain[:port].
+func bucketFromHost(host string) (string, bool) {
+	if BaseDomain == "" {
+		return "", false
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	bucketName, found := strings.CutSuffix(strings.ToLower(host), "."+BaseDomain)
+	if !found || bucketName == "" {
+		return "", false
+	}
+	return bucketName, true
+}
+
+// RewriteVirtualHost переводит virtual-hosted запрос в path-style, чтобы маршрутизация
+// и обработчики видели /{bucket}/{key} в обоих режимах. Вызывается после проверки
+// подписи: клиент подписывает путь в том виде, в каком его отправил.
+func RewriteVirtualHost(r *http.Request) {
+	bucketName, ok := bucketFromHost(r.Host)
+	if !ok {
+		return
+	}
+	if r.URL.Path == "" || r.URL.Path == "/" {
+		r.URL.Path, r.URL.RawPath = "/"+bucketName, ""
+		return
+	}
+	r.URL.Path = "/" + bucketName + r.URL.Path
+	if r.URL.RawPath != "" {
+		r.URL.RawPath = "/" + bucketName + r.URL.RawPath
+	}
+}
+
+// systemDirName — служебная директория внутри бакета (незавершённые multipart-загрузки и т.п.).
+const systemDirName = ".triple-s"
+
+func isReservedObjectName(objectName string) bool {
+	return objectName == "objects.csv" || objectName == systemDirName || strings.HasPrefix(objectName, systemDirName+"/")
+}
+
 func IsValidDir(s string) bool {
 	if strings.Contains(s, ".") || strings.Contains(s, "..") || strings.Contains(s, "/") || strings.Contains(s, "\\") || strings.Contains(s, ":") || strings.Contains(s, "~") || strings.Contains(s, "*") {
 		return false
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func setBaseDomain(t *testing.T, domain string) {
+	t.Helper()
+	prev := BaseDomain
+	BaseDomain = domain
+	t.Cleanup(func() { BaseDomain = prev })
+}
+
+func TestBucketFromHost(t *testing.T) {
+	setBaseDomain(t, "s3.example.com")
+	tests := []struct {
+		host   string
+		bucket string
+		ok     bool
+	}{
+		{"my-bucket.s3.example.com", "my-bucket", true},
+		{"my-bucket.s3.example.com:8080", "my-bucket", true},
+		{"My-Bucket.S3.Example.com", "my-bucket", true},
+		{"s3.example.com", "", false},
+		{"s3.example.com:8080", "", false},
+		{".s3.example.com", "", false},
+		{"my-bucket.other.com", "", false},
+		{"localhost:8080", "", false},
+	}
+	for _, tt := range tests {
+		bucket, ok := bucketFromHost(tt.host)
+		if bucket != tt.bucket || ok != tt.ok {
+			t.Errorf("bucketFromHost(%q) = %q, %v; ожидалось %q, %v", tt.host, bucket, ok, tt.bucket, tt.ok)
+		}
+	}
+
+	setBaseDomain(t, "")
+	if _, ok := bucketFromHost("my-bucket.s3.example.com"); ok {
+		t.Error("без --domain имя бакета взято из Host")
+	}
+}
+
+func TestRewriteVirtualHost(t *testing.T) {
+	setBaseDomain(t, "s3.example.com")
+	tests := []struct {
+		host, target      string
+		wantPath, wantRaw string
+	}{
+		{"my-bucket.s3.example.com", "/", "/my-bucket", ""},
+		{"my-bucket.s3.example.com", "/dir/key.txt", "/my-bucket/dir/key.txt", ""},
+		{"my-bucket.s3.example.com", "/a%2Fb?tagging", "/my-bucket/a/b", "/my-bucket/a%2Fb"},
+		{"s3.example.com", "/my-bucket/key", "/my-bucket/key", ""},
+		{"localhost:8080", "/my-bucket/key", "/my-bucket/key", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		r.Host = tt.host
+		RewriteVirtualHost(r)
+		if r.URL.Path != tt.wantPath || r.URL.RawPath != tt.wantRaw {
+			t.Errorf("%s%s: путь %q (%q), ожидалось %q (%q)", tt.host, tt.target, r.URL.Path, r.URL.RawPath, tt.wantPath, tt.wantRaw)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/key?tagging", nil)
+	r.Host = "my-bucket.s3.example.com"
+	RewriteVirtualHost(r)
+	if r.URL.RawQuery != "tagging" {
+		t.Errorf("запрос изменился: %q", r.URL.RawQuery)
+	}
+}
+
+func TestVirtualHostRequest(t *testing.T) {
+	setupTestStore(t)
+	setBaseDomain(t, "s3.example.com")
+	mustCreateBucket(t, "host-bucket")
+	mustPutObject(t, "host-bucket", "dir/key", "hello", nil)
+
+	credentialStore = map[string]string{exampleAccessKey: exampleSecretKey}
+
+	// Подпись проверяется по пути, который отправил клиент, до перевода в path-style.
+	r := httptest.NewRequest("GET", "http://host-bucket.s3.example.com/dir/key", nil)
+	signTestRequest(r, exampleAccessKey, exampleSecretKey)
+	if err := verifyRequest(r); err != nil {
+		t.Fatalf("подпись virtual-host запроса: %s: %s", err.code, err.message)
+	}
+	RewriteVirtualHost(r)
+	w := httptest.NewRecorder()
+	GetObjectHandler(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("GET через virtual-host: %d %q", w.Code, w.Body)
+	}
+}
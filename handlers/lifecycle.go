@@ -0,0 +1,556 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	lifecycleFileName = "lifecycle.xml"
+	maxLifecycleRules = 1000
+)
+
+type LifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration"`
+	Xmlns   string          `xml:"xmlns,attr,omitempty"`
+	Rules   []LifecycleRule `xml:"Rule"`
+}
+
+type LifecycleRule struct {
+	ID                             string                          `xml:"ID,omitempty"`
+	Prefix                         string                          `xml:"Prefix,omitempty"`
+	Filter                         *LifecycleFilter                `xml:"Filter,omitempty"`
+	Status                         string                          `xml:"Status"`
+	Expiration                     *LifecycleExpiration            `xml:"Expiration,omitempty"`
+	NoncurrentVersionExpiration    *NoncurrentVersionExpiration    `xml:"NoncurrentVersionExpiration,omitempty"`
+	AbortIncompleteMultipartUpload *AbortIncompleteMultipartUpload `xml:"AbortIncompleteMultipartUpload,omitempty"`
+}
+
+type LifecycleFilter struct {
+	Prefix string        `xml:"Prefix,omitempty"`
+	Tag    *Tag          `xml:"Tag,omitempty"`
+	And    *LifecycleAnd `xml:"And,omitempty"`
+}
+
+type LifecycleAnd struct {
+	Prefix string `xml:"Prefix,omitempty"`
+	Tags   []Tag  `xml:"Tag"`
+}
+
+type Tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+type LifecycleExpiration struct {
+	Days                      int    `xml:"Days,omitempty"`
+	Date                      string `xml:"Date,omitempty"`
+	ExpiredObjectDeleteMarker bool   `xml:"ExpiredObjectDeleteMarker,omitempty"`
+}
+
+type NoncurrentVersionExpiration struct {
+	NoncurrentDays          int `xml:"NoncurrentDays"`
+	NewerNoncurrentVersions int `xml:"NewerNoncurrentVersions,omitempty"`
+}
+
+type AbortIncompleteMultipartUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation"`
+}
+
+func (rule LifecycleRule) prefix() string {
+	switch {
+	case rule.Filter == nil:
+		return rule.Prefix
+	case rule.Filter.And != nil:
+		return rule.Filter.And.Prefix
+	default:
+		return rule.Filter.Prefix
+	}
+}
+
+func (rule LifecycleRule) tags() []Tag {
+	switch {
+	case rule.Filter == nil:
+		return nil
+	case rule.Filter.And != nil:
+		return rule.Filter.And.Tags
+	case rule.Filter.Tag != nil:
+		return []Tag{*rule.Filter.Tag}
+	default:
+		return nil
+	}
+}
+
+// matches проверяет фильтр правила: префикс ключа и все теги фильтра.
+func (rule LifecycleRule) matches(object ObjectMetadata) bool {
+	if rule.Status != "Enabled" || !strings.HasPrefix(object.Key, rule.prefix()) {
+		return false
+	}
+	return hasTags(object.Tags, rule.tags())
+}
+
+// expired сообщает, истёк ли срок по Days или Date для объекта, созданного в created.
+func (e *LifecycleExpiration) expired(created, now time.Time) bool {
+	if e == nil {
+		return false
+	}
+	if e.Days > 0 {
+		return !now.Before(lifecycleDeadline(created, e.Days))
+	}
+	if e.Date != "" {
+		date, err := time.Parse(time.RFC3339, e.Date)
+		return err == nil && !now.Before(date)
+	}
+	return false
+}
+
+// lifecycleDeadline, как и в S3, прибавляет дни и округляет вверх до полуночи UTC.
+func lifecycleDeadline(t time.Time, days int) time.Time {
+	deadline := t.UTC().AddDate(0, 0, days)
+	midnight := time.Date(deadline.Year(), deadline.Month(), deadline.Day(), 0, 0, 0, 0, time.UTC)
+	if midnight.Before(deadline) {
+		midnight = midnight.AddDate(0, 0, 1)
+	}
+	return midnight
+}
+
+func validateLifecycle(config *LifecycleConfiguration) error {
+	if len(config.Rules) == 0 || len(config.Rules) > maxLifecycleRules {
+		return fmt.Errorf("конфигурация должна содержать от 1 до %d правил", maxLifecycleRules)
+	}
+
+	ids := make(map[string]bool)
+	for _, rule := range config.Rules {
+		if len(rule.ID) > 255 {
+			return fmt.Errorf("ID правила длиннее 255 символов")
+		}
+		if rule.ID != "" {
+			if ids[rule.ID] {
+				return fmt.Errorf("ID правила %s повторяется", rule.ID)
+			}
+			ids[rule.ID] = true
+		}
+		if rule.Status != "Enabled" && rule.Status != "Disabled" {
+			return fmt.Errorf("Status должен быть Enabled или Disabled")
+		}
+		if rule.Filter != nil {
+			if rule.Prefix != "" {
+				return fmt.Errorf("нельзя одновременно указывать Prefix и Filter")
+			}
+			if rule.Filter.And != nil && (rule.Filter.Prefix != "" || rule.Filter.Tag != nil) {
+				return fmt.Errorf("внутри Filter допускается только одно из Prefix, Tag или And")
+			}
+			if rule.Filter.Prefix != "" && rule.Filter.Tag != nil {
+				return fmt.Errorf("для Prefix и Tag одновременно используйте And")
+			}
+			if err := validateTags(rule.tags()); err != nil {
+				return err
+			}
+		}
+		// У маркеров удаления и незавершённых загрузок тегов нет.
+		if len(rule.tags()) > 0 && (rule.AbortIncompleteMultipartUpload != nil || (rule.Expiration != nil && rule.Expiration.ExpiredObjectDeleteMarker)) {
+			return fmt.Errorf("фильтр по тегам нельзя сочетать с ExpiredObjectDeleteMarker и AbortIncompleteMultipartUpload")
+		}
+		if rule.Expiration == nil && rule.NoncurrentVersionExpiration == nil && rule.AbortIncompleteMultipartUpload == nil {
+			return fmt.Errorf("правило должно содержать хотя бы одно действие")
+		}
+
+		if e := rule.Expiration; e != nil {
+			set := 0
+			if e.Days != 0 {
+				set++
+			}
+			if e.Date != "" {
+				set++
+			}
+			if e.ExpiredObjectDeleteMarker {
+				set++
+			}
+			if set != 1 {
+				return fmt.Errorf("в Expiration укажите ровно одно из Days, Date или ExpiredObjectDeleteMarker")
+			}
+			if e.Days < 0 {
+				return fmt.Errorf("Days должно быть положительным")
+			}
+			if e.Date != "" {
+				date, err := time.Parse(time.RFC3339, e.Date)
+				if err != nil || !date.Equal(date.UTC().Truncate(24*time.Hour)) {
+					return fmt.Errorf("Date должна быть полночью по UTC в формате ISO 8601")
+				}
+			}
+		}
+		if n := rule.NoncurrentVersionExpiration; n != nil {
+			if n.NoncurrentDays <= 0 {
+				return fmt.Errorf("NoncurrentDays должно быть положительным")
+			}
+			if n.NewerNoncurrentVersions < 0 || n.NewerNoncurrentVersions > 100 {
+				return fmt.Errorf("NewerNoncurrentVersions должно быть от 0 до 100")
+			}
+		}
+		if a := rule.AbortIncompleteMultipartUpload; a != nil {
+			if a.DaysAfterInitiation <= 0 {
+				return fmt.Errorf("DaysAfterInitiation должно быть положительным")
+			}
+			if len(rule.tags()) > 0 {
+				return fmt.Errorf("AbortIncompleteMultipartUpload нельзя использовать с фильтром по тегам")
+			}
+		}
+	}
+	return nil
+}
+
+// Конфигурация жизненного цикла, как и multipart-загрузки, хранится в служебной директории бакета.
+func lifecyclePath(bucketName string) string {
+	return filepath.Join(BaseDir, bucketName, systemDirName, lifecycleFileName)
+}
+
+// readLifecycle возвращает nil без ошибки, если конфигурация не задана.
+func readLifecycle(bucketName string) (*LifecycleConfiguration, error) {
+	data, err := os.ReadFile(lifecyclePath(bucketName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать %s: %v", lifecycleFileName, err)
+	}
+
+	var config LifecycleConfiguration
+	if err := xml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("повреждён файл %s: %v", lifecycleFileName, err)
+	}
+	return &config, nil
+}
+
+func writeLifecycle(bucketName string, config *LifecycleConfiguration) error {
+	path := lifecyclePath(bucketName)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("не удалось создать служебную директорию: %v", err)
+	}
+
+	data, err := xml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("не удалось сериализовать конфигурацию: %v", err)
+	}
+
+	err = writeFileAtomic(path, filepath.Dir(path), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("не удалось записать файл %s: %v", lifecycleFileName, err)
+	}
+	return nil
+}
+
+func PutBucketLifecycleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName := strings.Trim(r.URL.Path, "/")
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if !exists {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	var config LifecycleConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		if writePayloadError(w, r, err) {
+			return
+		}
+		WriteS3Error(w, r, http.StatusBadRequest, "MalformedXML", "Некорректное тело запроса")
+		return
+	}
+	if err := validateLifecycle(&config); err != nil {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+
+	config.Xmlns = ""
+	if err := writeLifecycle(bucketName, &config); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка сохранения конфигурации жизненного цикла")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func GetBucketLifecycleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName := strings.Trim(r.URL.Path, "/")
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if !exists {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	config, err := readLifecycle(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения конфигурации жизненного цикла")
+		return
+	}
+	if config == nil {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchLifecycleConfiguration", "Конфигурация жизненного цикла не задана")
+		return
+	}
+
+	config.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+	writeXMLResult(w, http.StatusOK, config)
+}
+
+func DeleteBucketLifecycleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName := strings.Trim(r.URL.Path, "/")
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if !exists {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	if err := os.Remove(lifecyclePath(bucketName)); err != nil && !os.IsNotExist(err) {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка удаления конфигурации жизненного цикла")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StartLifecycleWorker сразу и затем раз в interval применяет правила жизненного цикла ко всем бакетам.
+// После отмены ctx обработчик доделывает текущий проход и закрывает возвращённый канал.
+func StartLifecycleWorker(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ApplyLifecycleRules(time.Now().UTC())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return done
+}
+
+func ApplyLifecycleRules(now time.Time) {
+	buckets, err := Store.ListBuckets()
+	if err != nil {
+		log.Printf("Жизненный цикл: не удалось получить список бакетов: %v", err)
+		return
+	}
+
+	for i := range buckets {
+		config, err := readLifecycle(buckets[i].Name)
+		if err != nil {
+			log.Printf("Жизненный цикл: бакет %s: %v", buckets[i].Name, err)
+			continue
+		}
+		if config == nil {
+			continue
+		}
+		if err := applyBucketLifecycle(&buckets[i], config.Rules, now); err != nil {
+			log.Printf("Жизненный цикл: бакет %s: %v", buckets[i].Name, err)
+		}
+	}
+}
+
+func applyBucketLifecycle(bucket *BucketMetadata, rules []LifecycleRule, now time.Time) error {
+	versions, err := Store.ListObjectVersions(bucket.Name)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	// Версии идут по ключу, внутри ключа от новых к старым — обрабатываем ключ целиком.
+	for start := 0; start < len(versions); {
+		end := start + 1
+		for end < len(versions) && versions[end].Key == versions[start].Key {
+			end++
+		}
+		unlock := lockObject(bucket.Name, versions[start].Key)
+		keyChanged, err := applyKeyLifecycle(bucket, rules, versions[start:end], now)
+		unlock()
+		if err != nil {
+			return err
+		}
+		changed = changed || keyChanged
+		start = end
+	}
+
+	if err := abortExpiredUploads(bucket.Name, rules, now); err != nil {
+		return err
+	}
+
+	if changed {
+		return UpdateBucketStatus(bucket.Name)
+	}
+	return nil
+}
+
+// applyKeyLifecycle применяет правила к версиям одного ключа, отсортированным от новых к старым.
+// Вызывается под замком ключа.
+func applyKeyLifecycle(bucket *BucketMetadata, rules []LifecycleRule, versions []ObjectMetadata, now time.Time) (bool, error) {
+	latest := versions[0]
+
+	// Версии прочитаны до того, как взят замок ключа, и могли устареть. Перед первым изменением
+	// сверяем их с метаданными; если ключ успели изменить, он подождёт следующего прохода.
+	checked := false
+	stale := func() (bool, error) {
+		if checked {
+			return false, nil
+		}
+		checked = true
+		current, err := Store.GetObjectVersions(bucket.Name, latest.Key)
+		if err != nil {
+			return false, err
+		}
+		return !sameVersions(current, versions), nil
+	}
+
+	if !latest.DeleteMarker {
+		for _, rule := range rules {
+			if !rule.matches(latest) || !rule.Expiration.expired(latest.LastModifiedTime(), now) {
+				continue
+			}
+			if isStale, err := stale(); err != nil || isStale {
+				return false, err
+			}
+			// В версионируемом бакете истёкший объект лишь скрывается маркером удаления,
+			// а прежние версии дожидаются NoncurrentVersionExpiration.
+			if bucket.Versioning == "" {
+				return true, removeObjectVersion(bucket.Name, latest)
+			}
+			_, err := putDeleteMarker(bucket, latest.Key)
+			return true, err
+		}
+	}
+
+	changed := false
+	kept := []ObjectMetadata{latest}
+	for i := 1; i < len(versions); i++ {
+		version := versions[i]
+		// Версия стала неактуальной, когда появилась следующая за ней.
+		noncurrentSince := versions[i-1].LastModifiedTime()
+		expired := false
+		for _, rule := range rules {
+			n := rule.NoncurrentVersionExpiration
+			if n == nil || !rule.matches(version) || i-1 < n.NewerNoncurrentVersions {
+				continue
+			}
+			if !now.Before(lifecycleDeadline(noncurrentSince, n.NoncurrentDays)) {
+				expired = true
+				break
+			}
+		}
+		if !expired {
+			kept = append(kept, version)
+			continue
+		}
+		if isStale, err := stale(); err != nil || isStale {
+			return changed, err
+		}
+		if err := removeObjectVersion(bucket.Name, version); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+
+	// Маркер удаления без единой версии под ним больше ничего не скрывает.
+	if len(kept) == 1 && latest.DeleteMarker {
+		for _, rule := range rules {
+			if rule.Expiration != nil && rule.Expiration.ExpiredObjectDeleteMarker && rule.matches(latest) {
+				if isStale, err := stale(); err != nil || isStale {
+					return changed, err
+				}
+				return true, removeObjectVersion(bucket.Name, latest)
+			}
+		}
+	}
+	return changed, nil
+}
+
+func sameVersions(a, b []ObjectMetadata) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].VersionID != b[i].VersionID || a[i].LastModified != b[i].LastModified ||
+			a[i].StoredETag != b[i].StoredETag || a[i].DeleteMarker != b[i].DeleteMarker {
+			return false
+		}
+	}
+	return true
+}
+
+func abortExpiredUploads(bucketName string, rules []LifecycleRule, now time.Time) error {
+	entries, err := os.ReadDir(multipartDir(bucketName))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("не удалось прочитать список загрузок: %v", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !isValidUploadID(entry.Name()) {
+			continue
+		}
+		upload, err := readMultipartUpload(bucketName, entry.Name())
+		if err != nil {
+			continue
+		}
+		initiated, err := time.Parse(time.RFC3339, upload.Initiated)
+		if err != nil {
+			continue
+		}
+
+		for _, rule := range rules {
+			a := rule.AbortIncompleteMultipartUpload
+			if a == nil || rule.Status != "Enabled" || !strings.HasPrefix(upload.Key, rule.prefix()) {
+				continue
+			}
+			if now.Before(lifecycleDeadline(initiated, a.DaysAfterInitiation)) {
+				continue
+			}
+			unlock := lockUpload(bucketName, upload.UploadID)
+			err := os.RemoveAll(uploadDir(bucketName, upload.UploadID))
+			unlock()
+			if err != nil {
+				return fmt.Errorf("не удалось отменить загрузку %s: %v", upload.UploadID, err)
+			}
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func mustPutLifecycle(t *testing.T, bucketName, rules string) {
+	t.Helper()
+	body := "<LifecycleConfiguration>" + rules + "</LifecycleConfiguration>"
+	if w := serve(PutBucketLifecycleHandler, "PUT", "/"+bucketName+"?lifecycle", body, nil); w.Code != http.StatusOK {
+		t.Fatalf("конфигурация жизненного цикла: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestLifecycleDeadline(t *testing.T) {
+	tests := []struct {
+		created string
+		days    int
+		want    string
+	}{
+		{"2024-01-01T00:00:00Z", 1, "2024-01-02T00:00:00Z"},
+		{"2024-01-01T10:30:00Z", 1, "2024-01-03T00:00:00Z"},
+		{"2024-02-28T23:59:59Z", 1, "2024-03-01T00:00:00Z"},
+		{"2024-12-31T12:00:00Z", 30, "2025-01-31T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		created, _ := time.Parse(time.RFC3339, tt.created)
+		if got := lifecycleDeadline(created, tt.days).Format(time.RFC3339); got != tt.want {
+			t.Errorf("lifecycleDeadline(%s, %d) = %s, ожидалось %s", tt.created, tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestPutBucketLifecycleValidation(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "rules-bucket")
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"без правил", "<LifecycleConfiguration></LifecycleConfiguration>"},
+		{"без действия", "<LifecycleConfiguration><Rule><Status>Enabled</Status></Rule></LifecycleConfiguration>"},
+		{"неверный Status", "<LifecycleConfiguration><Rule><Status>On</Status><Expiration><Days>1</Days></Expiration></Rule></LifecycleConfiguration>"},
+		{"Days и Date вместе", "<LifecycleConfiguration><Rule><Status>Enabled</Status><Expiration><Days>1</Days><Date>2024-01-01T00:00:00Z</Date></Expiration></Rule></LifecycleConfiguration>"},
+		{"Date не в полночь", "<LifecycleConfiguration><Rule><Status>Enabled</Status><Expiration><Date>2024-01-01T10:00:00Z</Date></Expiration></Rule></LifecycleConfiguration>"},
+		{"теги с AbortIncompleteMultipartUpload", "<LifecycleConfiguration><Rule><Status>Enabled</Status><Filter><Tag><Key>k</Key><Value>v</Value></Tag></Filter><AbortIncompleteMultipartUpload><DaysAfterInitiation>1</DaysAfterInitiation></AbortIncompleteMultipartUpload></Rule></LifecycleConfiguration>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(PutBucketLifecycleHandler, "PUT", "/rules-bucket?lifecycle", tt.body, nil); w.Code != http.StatusBadRequest {
+				t.Errorf("код %d, тело %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestApplyLifecycleRulesExpiration(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "expire-bucket")
+	mustPutObject(t, "expire-bucket", "logs/old", "x", nil)
+	mustPutObject(t, "expire-bucket", "keep/old", "x", nil)
+	mustPutObject(t, "expire-bucket", "tagged", "x", http.Header{"X-Amz-Tagging": {"temp=yes"}})
+	mustPutObject(t, "expire-bucket", "untagged", "x", nil)
+	mustPutLifecycle(t, "expire-bucket",
+		"<Rule><ID>logs</ID><Filter><Prefix>logs/</Prefix></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>"+
+			"<Rule><ID>temp</ID><Filter><Tag><Key>temp</Key><Value>yes</Value></Tag></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>"+
+			"<Rule><ID>off</ID><Filter><Prefix>keep/</Prefix></Filter><Status>Disabled</Status><Expiration><Days>1</Days></Expiration></Rule>")
+
+	ApplyLifecycleRules(time.Now().UTC())
+	if w := serve(GetObjectHandler, "GET", "/expire-bucket/logs/old", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("объект удалён до срока: %d", w.Code)
+	}
+
+	ApplyLifecycleRules(time.Now().UTC().AddDate(0, 0, 3))
+	for key, want := range map[string]int{
+		"logs/old": http.StatusNotFound,
+		"tagged":   http.StatusNotFound,
+		"keep/old": http.StatusOK,
+		"untagged": http.StatusOK,
+	} {
+		if w := serve(GetObjectHandler, "GET", "/expire-bucket/"+key, "", nil); w.Code != want {
+			t.Errorf("%s: код %d, ожидался %d", key, w.Code, want)
+		}
+	}
+	if _, err := ObjectBackend.Stat("expire-bucket", "logs/old"); err == nil {
+		t.Error("содержимое истёкшего объекта осталось в хранилище")
+	}
+}
+
+func TestApplyLifecycleRulesVersioned(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "expire-bucket")
+	mustSetVersioning(t, "expire-bucket", "Enabled")
+	mustPutObject(t, "expire-bucket", "key", "one", nil)
+	mustPutObject(t, "expire-bucket", "key", "two", nil)
+	mustPutLifecycle(t, "expire-bucket",
+		"<Rule><Status>Enabled</Status><Expiration><Days>1</Days></Expiration>"+
+			"<NoncurrentVersionExpiration><NoncurrentDays>1</NoncurrentDays></NoncurrentVersionExpiration></Rule>"+
+			"<Rule><Status>Enabled</Status><Expiration><ExpiredObjectDeleteMarker>true</ExpiredObjectDeleteMarker></Expiration></Rule>")
+
+	later := time.Now().UTC().AddDate(0, 0, 3)
+	ApplyLifecycleRules(later)
+	versions, _ := Store.GetObjectVersions("expire-bucket", "key")
+	if len(versions) != 3 || !versions[0].DeleteMarker {
+		t.Fatalf("после первого прохода ожидался маркер над двумя версиями: %+v", versions)
+	}
+
+	// Второй проход удаляет неактуальные версии, а за ними и оставшийся без версий маркер.
+	ApplyLifecycleRules(later)
+	if versions, _ := Store.GetObjectVersions("expire-bucket", "key"); len(versions) != 0 {
+		t.Errorf("после второго прохода остались версии: %+v", versions)
+	}
+}
+
+func TestApplyLifecycleRulesAbortUploads(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "expire-bucket")
+	uploadID := mustCreateUpload(t, "expire-bucket", "tmp/big")
+	keptID := mustCreateUpload(t, "expire-bucket", "data/big")
+	mustPutLifecycle(t, "expire-bucket",
+		"<Rule><Filter><Prefix>tmp/</Prefix></Filter><Status>Enabled</Status>"+
+			"<AbortIncompleteMultipartUpload><DaysAfterInitiation>1</DaysAfterInitiation></AbortIncompleteMultipartUpload></Rule>")
+
+	ApplyLifecycleRules(time.Now().UTC().AddDate(0, 0, 3))
+	if w := serve(ListPartsHandler, "GET", "/expire-bucket/tmp/big?uploadId="+uploadID, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("истёкшая загрузка не отменена: %d", w.Code)
+	}
+	if w := serve(ListPartsHandler, "GET", "/expire-bucket/data/big?uploadId="+keptID, "", nil); w.Code != http.StatusOK {
+		t.Errorf("загрузка вне префикса отменена: %d", w.Code)
+	}
+}
+
+func TestStartLifecycleWorkerStops(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "expire-bucket")
+	mustPutObject(t, "expire-bucket", "key", "x", nil)
+	mustPutLifecycle(t, "expire-bucket", "<Rule><Status>Enabled</Status><Expiration><Date>2000-01-01T00:00:00Z</Date></Expiration></Rule>")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := StartLifecycleWorker(ctx, time.Hour)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("обработчик не остановился после отмены")
+	}
+	// Первый проход выполняется сразу при запуске.
+	if w := serve(GetObjectHandler, "GET", "/expire-bucket/key", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("объект с истёкшей датой не удалён: %d", w.Code)
+	}
+}
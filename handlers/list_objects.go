@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxListKeys = 1000
+
+type ObjectContent struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag,omitempty"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type ListBucketResult struct {
+	XMLName               xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string          `xml:"Name"`
+	Prefix                string          `xml:"Prefix"`
+	Delimiter             string          `xml:"Delimiter,omitempty"`
+	MaxKeys               int             `xml:"MaxKeys"`
+	KeyCount              int             `xml:"KeyCount"`
+	IsTruncated           bool            `xml:"IsTruncated"`
+	EncodingType          string          `xml:"EncodingType,omitempty"`
+	ContinuationToken     string          `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string          `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string          `xml:"StartAfter,omitempty"`
+	Contents              []ObjectContent `xml:"Contents"`
+	CommonPrefixes        []CommonPrefix  `xml:"CommonPrefixes"`
+}
+
+// ListBucketResultV1 — ответ ListObjects без list-type: вместо continuation-token
+// страницы продолжаются по marker и NextMarker.
+type ListBucketResultV1 struct {
+	XMLName        xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name           string          `xml:"Name"`
+	Prefix         string          `xml:"Prefix"`
+	Marker         string          `xml:"Marker"`
+	NextMarker     string          `xml:"NextMarker,omitempty"`
+	Delimiter      string          `xml:"Delimiter,omitempty"`
+	MaxKeys        int             `xml:"MaxKeys"`
+	IsTruncated    bool            `xml:"IsTruncated"`
+	EncodingType   string          `xml:"EncodingType,omitempty"`
+	Contents       []ObjectContent `xml:"Contents"`
+	CommonPrefixes []CommonPrefix  `xml:"CommonPrefixes"`
+}
+
+func formatS3Time(timestamp string) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func ListObjectsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName := strings.Trim(r.URL.Path, "/")
+	query := r.URL.Query()
+
+	listType := query.Get("list-type")
+	if listType != "" && listType != "2" {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Поддерживается только list-type=2")
+		return
+	}
+
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if !exists {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	maxKeys := maxListKeys
+	if value := query.Get("max-keys"); value != "" {
+		maxKeys, err = strconv.Atoi(value)
+		if err != nil || maxKeys < 0 {
+			WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Некорректное значение max-keys")
+			return
+		}
+		if maxKeys > maxListKeys {
+			maxKeys = maxListKeys
+		}
+	}
+
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Некорректное значение encoding-type")
+		return
+	}
+
+	// tag-filter — расширение S3: в списке остаются только объекты со всеми указанными
+	// тегами, формат тот же, что у заголовка x-amz-tagging.
+	tagFilter, err := parseTags(query.Get("tag-filter"))
+	if err != nil {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Некорректное значение tag-filter: "+err.Error())
+		return
+	}
+
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	startAfter := query.Get("start-after")
+	continuationToken := query.Get("continuation-token")
+
+	// Ключи внутри маркера пропускаются, только если прошлая страница закончилась
+	// свёрнутым общим префиксом. start-after всегда сравнивается как обычный ключ.
+	marker, markerIsPrefix := startAfter, false
+	if listType == "" {
+		// NextMarker в V1 — ключ или общий префикс. Ключ, выданный с тем же разделителем,
+		// не совпадает со своим общим префиксом, так что совпадение означает префикс.
+		marker = query.Get("marker")
+		markerIsPrefix = marker != "" && rolledUpPrefix(marker, prefix, delimiter) == marker
+	} else if continuationToken != "" {
+		var ok bool
+		marker, markerIsPrefix, ok = decodeContinuationToken(continuationToken)
+		if !ok {
+			WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Некорректный continuation-token")
+			return
+		}
+	}
+
+	objects, err := Store.ListObjects(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных объектов")
+		return
+	}
+
+	encode := func(s string) string {
+		if encodingType == "url" {
+			return url.QueryEscape(s)
+		}
+		return s
+	}
+
+	result := ListBucketResult{
+		Name:              bucketName,
+		Prefix:            encode(prefix),
+		Delimiter:         encode(delimiter),
+		MaxKeys:           maxKeys,
+		EncodingType:      encodingType,
+		ContinuationToken: continuationToken,
+		StartAfter:        encode(startAfter),
+	}
+
+	lastEntry, lastIsPrefix := "", false
+	for _, object := range objects {
+		if !strings.HasPrefix(object.Key, prefix) || object.Key <= marker || !hasTags(object.Tags, tagFilter) {
+			continue
+		}
+		if markerIsPrefix && strings.HasPrefix(object.Key, marker) {
+			continue
+		}
+
+		commonPrefix := rolledUpPrefix(object.Key, prefix, delimiter)
+		if commonPrefix != "" && commonPrefix == lastEntry {
+			continue
+		}
+
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+
+		if commonPrefix != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, CommonPrefix{Prefix: encode(commonPrefix)})
+			lastEntry, lastIsPrefix = commonPrefix, true
+		} else {
+			result.Contents = append(result.Contents, ObjectContent{
+				Key:          encode(object.Key),
+				LastModified: formatS3Time(object.LastModified),
+				ETag:         object.ETag(),
+				Size:         object.Size,
+				StorageClass: "STANDARD",
+			})
+			lastEntry, lastIsPrefix = object.Key, false
+		}
+		result.KeyCount++
+	}
+
+	if listType == "" {
+		v1 := ListBucketResultV1{
+			Name:           result.Name,
+			Prefix:         result.Prefix,
+			Marker:         encode(marker),
+			Delimiter:      result.Delimiter,
+			MaxKeys:        result.MaxKeys,
+			IsTruncated:    result.IsTruncated,
+			EncodingType:   result.EncodingType,
+			Contents:       result.Contents,
+			CommonPrefixes: result.CommonPrefixes,
+		}
+		if result.IsTruncated {
+			v1.NextMarker = encode(lastEntry)
+		}
+		writeXMLResult(w, http.StatusOK, v1)
+		return
+	}
+
+	if result.IsTruncated {
+		result.NextContinuationToken = encodeContinuationToken(lastEntry, lastIsPrefix)
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(result)
+}
+
+// rolledUpPrefix возвращает общий префикс, в который сворачивается ключ, или пустую строку.
+func rolledUpPrefix(key, prefix, delimiter string) string {
+	if delimiter == "" || !strings.HasPrefix(key, prefix) {
+		return ""
+	}
+	rest := key[len(prefix):]
+	if idx := strings.Index(rest, delimiter); idx >= 0 {
+		return prefix + rest[:idx+len(delimiter)]
+	}
+	return ""
+}
+
+// continuation-token хранит последний элемент страницы с отметкой его вида:
+// "p" для общего префикса и "k" для ключа объекта.
+func encodeContinuationToken(entry string, commonPrefix bool) string {
+	kind := "k"
+	if commonPrefix {
+		kind = "p"
+	}
+	return base64.URLEncoding.EncodeToString([]byte(kind + entry))
+}
+
+func decodeContinuationToken(token string) (entry string, commonPrefix bool, ok bool) {
+	decoded, err := base64.URLEncoding.DecodeString(token)
+	if err != nil || len(decoded) == 0 {
+		return "", false, false
+	}
+	switch decoded[0] {
+	case 'p':
+		return string(decoded[1:]), true, true
+	case 'k':
+		return string(decoded[1:]), false, true
+	}
+	return "", false, false
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+// listAllPages проходит ListObjectsV2 по continuation-token и возвращает элементы
+// в порядке выдачи: ключи как есть, общие префиксы с пометкой "prefix:".
+func listAllPages(t *testing.T, bucketName string, query url.Values) []string {
+	t.Helper()
+	var entries []string
+	for page := 0; page < 100; page++ {
+		query.Set("list-type", "2")
+		w := serve(ListObjectsHandler, "GET", "/"+bucketName+"?"+query.Encode(), "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("ListObjectsV2 %s: %d %s", query.Encode(), w.Code, w.Body)
+		}
+		var result ListBucketResult
+		if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("разбор ответа: %v", err)
+		}
+		for _, content := range result.Contents {
+			entries = append(entries, content.Key)
+		}
+		for _, prefix := range result.CommonPrefixes {
+			entries = append(entries, "prefix:"+prefix.Prefix)
+		}
+		if !result.IsTruncated {
+			return entries
+		}
+		if result.NextContinuationToken == "" {
+			t.Fatalf("усечённая страница без NextContinuationToken: %s", query.Encode())
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	t.Fatalf("ListObjectsV2 не закончился за 100 страниц: %s", query.Encode())
+	return nil
+}
+
+func TestListObjectsV2Paging(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "photos-bucket")
+	for _, key := range []string{"a", "photos/", "photos/1", "photos/2", "photos/sub/3", "z"} {
+		mustPutObject(t, "photos-bucket", key, "x", nil)
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  []string
+	}{
+		{
+			name:  "все ключи по одному",
+			query: url.Values{"max-keys": {"1"}},
+			want:  []string{"a", "photos/", "photos/1", "photos/2", "photos/sub/3", "z"},
+		},
+		{
+			name:  "все ключи одной страницей",
+			query: url.Values{},
+			want:  []string{"a", "photos/", "photos/1", "photos/2", "photos/sub/3", "z"},
+		},
+		{
+			name:  "общий префикс не повторяется на следующей странице",
+			query: url.Values{"delimiter": {"/"}, "max-keys": {"1"}},
+			want:  []string{"a", "prefix:photos/", "z"},
+		},
+		{
+			name:  "ключ-папка в конце страницы не скрывает вложенные ключи",
+			query: url.Values{"prefix": {"photos/"}, "max-keys": {"1"}},
+			want:  []string{"photos/", "photos/1", "photos/2", "photos/sub/3"},
+		},
+		{
+			name:  "ключ-папка с разделителем",
+			query: url.Values{"prefix": {"photos/"}, "delimiter": {"/"}, "max-keys": {"1"}},
+			want:  []string{"photos/", "photos/1", "photos/2", "prefix:photos/sub/"},
+		},
+		{
+			name:  "start-after сравнивается как обычный ключ",
+			query: url.Values{"start-after": {"photos/"}},
+			want:  []string{"photos/1", "photos/2", "photos/sub/3", "z"},
+		},
+		{
+			name:  "start-after с разделителем оставляет общий префикс",
+			query: url.Values{"start-after": {"photos/"}, "delimiter": {"/"}, "max-keys": {"1"}},
+			want:  []string{"prefix:photos/", "z"},
+		},
+		{
+			name:  "start-after после всех ключей",
+			query: url.Values{"start-after": {"zz"}},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listAllPages(t, "photos-bucket", tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("получено %q, ожидалось %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// listAllPagesV1 проходит ListObjects без list-type по NextMarker, а если его нет —
+// по последнему ключу страницы. Формат результата такой же, как у listAllPages.
+func listAllPagesV1(t *testing.T, bucketName string, query url.Values) []string {
+	t.Helper()
+	var entries []string
+	for page := 0; page < 100; page++ {
+		w := serve(ListObjectsHandler, "GET", "/"+bucketName+"?"+query.Encode(), "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("ListObjects %s: %d %s", query.Encode(), w.Code, w.Body)
+		}
+		var result ListBucketResultV1
+		if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("разбор ответа: %v", err)
+		}
+		if result.Marker != query.Get("marker") {
+			t.Fatalf("Marker %q, запрошен %q", result.Marker, query.Get("marker"))
+		}
+		for _, content := range result.Contents {
+			entries = append(entries, content.Key)
+		}
+		for _, prefix := range result.CommonPrefixes {
+			entries = append(entries, "prefix:"+prefix.Prefix)
+		}
+		if !result.IsTruncated {
+			return entries
+		}
+		next := result.NextMarker
+		if next == "" && len(result.Contents) > 0 {
+			next = result.Contents[len(result.Contents)-1].Key
+		}
+		if next == "" {
+			t.Fatalf("усечённая страница без NextMarker: %s", query.Encode())
+		}
+		query.Set("marker", next)
+	}
+	t.Fatalf("ListObjects не закончился за 100 страниц: %s", query.Encode())
+	return nil
+}
+
+func TestListObjectsV1Paging(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "photos-bucket")
+	for _, key := range []string{"a", "photos/", "photos/1", "photos/2", "photos/sub/3", "z"} {
+		mustPutObject(t, "photos-bucket", key, "x", nil)
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  []string
+	}{
+		{
+			name:  "все ключи по одному",
+			query: url.Values{"max-keys": {"1"}},
+			want:  []string{"a", "photos/", "photos/1", "photos/2", "photos/sub/3", "z"},
+		},
+		{
+			name:  "общий префикс в NextMarker не повторяется",
+			query: url.Values{"delimiter": {"/"}, "max-keys": {"1"}},
+			want:  []string{"a", "prefix:photos/", "z"},
+		},
+		{
+			name:  "ключ-папка с разделителем",
+			query: url.Values{"prefix": {"photos/"}, "delimiter": {"/"}, "max-keys": {"1"}},
+			want:  []string{"photos/", "photos/1", "photos/2", "prefix:photos/sub/"},
+		},
+		{
+			name:  "marker без разделителя сравнивается как ключ",
+			query: url.Values{"marker": {"photos/"}},
+			want:  []string{"photos/1", "photos/2", "photos/sub/3", "z"},
+		},
+		{
+			name:  "start-after и continuation-token в V1 не действуют",
+			query: url.Values{"start-after": {"z"}, "continuation-token": {"не base64"}},
+			want:  []string{"a", "photos/", "photos/1", "photos/2", "photos/sub/3", "z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listAllPagesV1(t, "photos-bucket", tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("получено %q, ожидалось %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContinuationToken(t *testing.T) {
+	tests := []struct {
+		entry        string
+		commonPrefix bool
+	}{
+		{"photos/", false},
+		{"photos/", true},
+		{"", false},
+		{"ключ с пробелом", false},
+	}
+	for _, tt := range tests {
+		entry, commonPrefix, ok := decodeContinuationToken(encodeContinuationToken(tt.entry, tt.commonPrefix))
+		if !ok || entry != tt.entry || commonPrefix != tt.commonPrefix {
+			t.Errorf("%q/%v: получено %q/%v/%v", tt.entry, tt.commonPrefix, entry, commonPrefix, ok)
+		}
+	}
+
+	for _, token := range []string{"", "не base64", "eHBob3Rvcy8="} {
+		if _, _, ok := decodeContinuationToken(token); ok {
+			t.Errorf("токен %q принят", token)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"sort"
+	"sync"
+)
+
+// lockRegistry выдаёт RWMutex по имени, создавая его при первом обращении, и забывает,
+// когда замок больше никто не держит и не ждёт, поэтому реестр не растёт с числом ключей.
+// Возвращаемую функцию разблокировки можно вызывать повторно: это позволяет отпустить
+// замок раньше и всё равно поставить её в defer.
+type lockRegistry struct {
+	mu    sync.Mutex
+	locks map[string]*namedLock
+	// gate держат на чтение все владельцы замков; closeAll берёт его на запись.
+	gate sync.RWMutex
+}
+
+type namedLock struct {
+	sync.RWMutex
+	refs int
+}
+
+func newLockRegistry() *lockRegistry {
+	return &lockRegistry{locks: make(map[string]*namedLock)}
+}
+
+func (r *lockRegistry) acquire(name string) *namedLock {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l := r.locks[name]
+	if l == nil {
+		l = &namedLock{}
+		r.locks[name] = l
+	}
+	l.refs++
+	return l
+}
+
+func (r *lockRegistry) release(name string, l *namedLock) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l.refs--
+	if l.refs == 0 {
+		delete(r.locks, name)
+	}
+}
+
+func (r *lockRegistry) lock(name string) func() {
+	r.gate.RLock()
+	l := r.acquire(name)
+	l.Lock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.Unlock()
+			r.release(name, l)
+			r.gate.RUnlock()
+		})
+	}
+}
+
+func (r *lockRegistry) rlock(name string) func() {
+	r.gate.RLock()
+	l := r.acquire(name)
+	l.RLock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.RUnlock()
+			r.release(name, l)
+			r.gate.RUnlock()
+		})
+	}
+}
+
+// lockAll берёт замки нескольких имён в порядке сортировки, чтобы два таких вызова
+// не ждали друг друга по кругу.
+func (r *lockRegistry) lockAll(names []string) func() {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	var unlocks []func()
+	for i, name := range sorted {
+		if i > 0 && name == sorted[i-1] {
+			continue
+		}
+		unlocks = append(unlocks, r.lock(name))
+	}
+	return func() {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}
+}
+
+// closeAll дожидается, пока отпустят все выданные замки, и больше их не выдаёт.
+func (r *lockRegistry) closeAll() {
+	r.gate.Lock()
+}
+
+// objectLocks защищают содержимое объектов: запись держит замок ключа от публикации данных
+// до записи метаданных, чтение — пока находит версию и открывает её содержимое.
+var objectLocks = newLockRegistry()
+
+func lockObject(bucketName, objectName string) func() {
+	return objectLocks.lock(bucketName + "/" + objectName)
+}
+
+func rlockObject(bucketName, objectName string) func() {
+	return objectLocks.rlock(bucketName + "/" + objectName)
+}
+
+func lockObjects(bucketName string, objectNames []string) func() {
+	names := make([]string, len(objectNames))
+	for i, objectName := range objectNames {
+		names[i] = bucketName + "/" + objectName
+	}
+	return objectLocks.lockAll(names)
+}
+
+// uploadLocks защищают список частей multipart-загрузки: приём части, сборка и отмена
+// одной загрузки исключают друг друга, а разные загрузки идут параллельно.
+var uploadLocks = newLockRegistry()
+
+func lockUpload(bucketName, uploadID string) func() {
+	return uploadLocks.lock(bucketName + "/" + uploadID)
+}
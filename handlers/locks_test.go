@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// acquiredWithin сообщает, успел ли take вернуться за d. Если не успел,
+// он продолжает ждать в горутине.
+func acquiredWithin(d time.Duration, take func()) bool {
+	done := make(chan struct{})
+	go func() {
+		take()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func TestLockRegistry(t *testing.T) {
+	r := newLockRegistry()
+	const wait = 50 * time.Millisecond
+
+	unlock := r.lock("a")
+	if !acquiredWithin(time.Second, func() { r.lock("b")() }) {
+		t.Fatal("замок другого имени ждёт чужой замок")
+	}
+	var second func()
+	secondDone := make(chan struct{})
+	go func() {
+		second = r.lock("a")
+		close(secondDone)
+	}()
+	select {
+	case <-secondDone:
+		t.Fatal("замок одного имени выдан дважды")
+	case <-time.After(wait):
+	}
+	unlock()
+	unlock() // повторный вызов ничего не делает
+	<-secondDone
+	second()
+
+	if n := len(r.locks); n != 0 {
+		t.Errorf("после разблокировки в реестре осталось %d замков", n)
+	}
+}
+
+func TestLockRegistryReaders(t *testing.T) {
+	r := newLockRegistry()
+	const wait = 50 * time.Millisecond
+
+	first := r.rlock("a")
+	if !acquiredWithin(time.Second, func() { r.rlock("a")() }) {
+		t.Fatal("читатели ждут друг друга")
+	}
+	if acquiredWithin(wait, func() { r.lock("a")() }) {
+		t.Fatal("запись не ждёт читателя")
+	}
+	first()
+}
+
+func TestLockRegistryLockAll(t *testing.T) {
+	r := newLockRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r.lockAll([]string{"a", "b", "c", "a"})()
+		}()
+		go func() {
+			defer wg.Done()
+			r.lockAll([]string{"c", "b", "a"})()
+		}()
+	}
+	if !acquiredWithin(5*time.Second, wg.Wait) {
+		t.Fatal("lockAll зациклился")
+	}
+	if n := len(r.locks); n != 0 {
+		t.Errorf("в реестре осталось %d замков", n)
+	}
+}
+
+func TestLockRegistryCloseAll(t *testing.T) {
+	r := newLockRegistry()
+	unlock := r.lock("a")
+	if acquiredWithin(50*time.Millisecond, r.closeAll) {
+		t.Fatal("closeAll не дождался выданного замка")
+	}
+	unlock()
+	if acquiredWithin(50*time.Millisecond, func() { r.lock("b") }) {
+		t.Error("замок выдан после closeAll")
+	}
+}
+
+func TestConcurrentUploadsSameKey(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "race-bucket")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			serve(UploadObjectHandler, "PUT", "/race-bucket/key", fmt.Sprintf("content-%d", i), nil)
+		}(i)
+	}
+	wg.Wait()
+
+	// Метаданные и содержимое должны описывать одну и ту же загрузку.
+	w := serve(GetObjectHandler, "GET", "/race-bucket/key", "", nil)
+	sum := md5.Sum(w.Body.Bytes())
+	if etag := `"` + hex.EncodeToString(sum[:]) + `"`; w.Header().Get("ETag") != etag {
+		t.Errorf("ETag %s не соответствует содержимому %q", w.Header().Get("ETag"), w.Body)
+	}
+}
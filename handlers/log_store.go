@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	logFileName          = "metadata.log"
+	minCompactionRecords = 1000
+)
+
+type logEntry struct {
+	Op        string          `json:"op"`
+	Bucket    string          `json:"bucket"`
+	Key       string          `json:"key,omitempty"`
+	VersionID string          `json:"versionId,omitempty"`
+	Meta      *BucketMetadata `json:"meta,omitempty"`
+	Object    *ObjectMetadata `json:"object,omitempty"`
+}
+
+// LogStore держит индекс метаданных в памяти, а каждое изменение дописывает в журнал metadata.log.
+// Запись дописывает одну строку в журнал; новый ключ вставляется в отсортированный список ключей
+// бакета за O(n). Поиск объекта — O(1), листинг идёт по заранее отсортированным ключам.
+// Когда мёртвых записей в журнале становится больше, чем живых, журнал переписывается снимком.
+type LogStore struct {
+	mu      sync.RWMutex
+	path    string
+	file    *os.File
+	buckets map[string]BucketMetadata
+	objects map[string]*objectIndex
+	records int
+}
+
+func NewLogStore(baseDir string) (*LogStore, error) {
+	store := &LogStore{
+		path:    filepath.Join(baseDir, logFileName),
+		buckets: make(map[string]BucketMetadata),
+		objects: make(map[string]*objectIndex),
+	}
+
+	if _, err := os.Stat(store.path); os.IsNotExist(err) {
+		if err := store.importCSV(baseDir); err != nil {
+			return nil, err
+		}
+		if err := store.compact(); err != nil {
+			return nil, err
+		}
+	} else if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(store.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть журнал метаданных: %v", err)
+	}
+	store.file = file
+	return store, nil
+}
+
+// importCSV переносит существующие buckets.csv и objects.csv при первом запуске с журналом.
+func (s *LogStore) importCSV(baseDir string) error {
+	if _, err := os.Stat(filepath.Join(baseDir, "buckets.csv")); os.IsNotExist(err) {
+		return nil
+	}
+
+	csvStore := &CSVStore{baseDir: baseDir, metadataFilePath: filepath.Join(baseDir, "buckets.csv")}
+	buckets, err := csvStore.readBuckets()
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		s.apply(logEntry{Op: "put_bucket", Bucket: bucket.Name, Meta: &bucket})
+		idx, err := csvStore.readObjects(bucket.Name)
+		if err != nil {
+			continue
+		}
+		objects := idx.records()
+		for i := range objects {
+			s.apply(logEntry{Op: "put_object", Bucket: bucket.Name, Object: &objects[i]})
+		}
+	}
+	return nil
+}
+
+func (s *LogStore) load() error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть журнал метаданных: %v", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) > 0 {
+				// Последняя запись не дописана из-за сбоя — отбрасываем её.
+				return os.Truncate(s.path, offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("не удалось прочитать журнал метаданных: %v", err)
+		}
+
+		var entry logEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("повреждена запись журнала метаданных на смещении %d: %v", offset, err)
+		}
+		s.apply(entry)
+		s.records++
+		offset += int64(len(line))
+	}
+}
+
+func (s *LogStore) apply(entry logEntry) {
+	switch entry.Op {
+	case "put_bucket":
+		s.buckets[entry.Bucket] = *entry.Meta
+		if s.objects[entry.Bucket] == nil {
+			s.objects[entry.Bucket] = newObjectIndex()
+		}
+	case "delete_bucket":
+		delete(s.buckets, entry.Bucket)
+		delete(s.objects, entry.Bucket)
+	case "put_object":
+		if s.objects[entry.Bucket] == nil {
+			s.objects[entry.Bucket] = newObjectIndex()
+		}
+		s.objects[entry.Bucket].put(*entry.Object)
+	case "update_object":
+		if idx := s.objects[entry.Bucket]; idx != nil {
+			idx.update(*entry.Object)
+		}
+	case "delete_object":
+		if idx := s.objects[entry.Bucket]; idx != nil {
+			idx.remove(entry.Key, entry.VersionID)
+		}
+	}
+}
+
+func (s *LogStore) liveRecords() int {
+	live := len(s.buckets)
+	for _, idx := range s.objects {
+		live += idx.size()
+	}
+	return live
+}
+
+func (s *LogStore) snapshot() []logEntry {
+	names := make([]string, 0, len(s.buckets))
+	for name := range s.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var entries []logEntry
+	for _, name := range names {
+		bucket := s.buckets[name]
+		entries = append(entries, logEntry{Op: "put_bucket", Bucket: name, Meta: &bucket})
+		objects := s.objects[name].records()
+		for i := range objects {
+			entries = append(entries, logEntry{Op: "put_object", Bucket: name, Object: &objects[i]})
+		}
+	}
+	return entries
+}
+
+// compact переписывает журнал снимком текущего состояния через временный файл.
+func (s *LogStore) compact() error {
+	entries := s.snapshot()
+	err := writeFileAtomic(s.path, filepath.Dir(s.path), func(w io.Writer) error {
+		writer := bufio.NewWriter(w)
+		encoder := json.NewEncoder(writer)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		return writer.Flush()
+	})
+	if err != nil {
+		return fmt.Errorf("не удалось записать снимок журнала: %v", err)
+	}
+	s.records = len(entries)
+
+	if s.file != nil {
+		s.file.Close()
+		file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("не удалось открыть журнал метаданных: %v", err)
+		}
+		s.file = file
+	}
+	return nil
+}
+
+// appendEntry должен вызываться под s.mu.Lock.
+func (s *LogStore) appendEntry(entry logEntry) error {
+	return s.appendEntries([]logEntry{entry})
+}
+
+// appendEntries дописывает записи одним fsync. Должен вызываться под s.mu.Lock.
+func (s *LogStore) appendEntries(entries []logEntry) error {
+	var buf []byte
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("не удалось сериализовать запись журнала: %v", err)
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+	info, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать размер журнала метаданных: %v", err)
+	}
+	if _, err := s.file.Write(buf); err != nil {
+		s.truncate(info.Size())
+		return fmt.Errorf("не удалось дописать журнал метаданных: %v", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		s.truncate(info.Size())
+		return fmt.Errorf("не удалось сохранить журнал метаданных: %v", err)
+	}
+
+	for _, entry := range entries {
+		s.apply(entry)
+	}
+	s.records += len(entries)
+
+	// Записи уже в журнале и в индексе: сбой сжатия не отменяет изменение,
+	// журнал просто останется длиннее до следующей попытки.
+	if s.records > minCompactionRecords && s.records > 2*s.liveRecords() {
+		if err := s.compact(); err != nil {
+			log.Printf("Не удалось сжать журнал метаданных: %v", err)
+		}
+	}
+	return nil
+}
+
+// truncate отрезает недописанные записи, чтобы следующая запись не склеилась с обрывком строки.
+func (s *LogStore) truncate(size int64) {
+	if err := s.file.Truncate(size); err != nil {
+		log.Printf("Не удалось отрезать недописанную запись журнала метаданных: %v", err)
+	}
+}
+
+func (s *LogStore) ListBuckets() ([]BucketMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	buckets := make([]BucketMetadata, 0, len(s.buckets))
+	for _, bucket := range s.buckets {
+		buckets = append(buckets, bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+	return buckets, nil
+}
+
+func (s *LogStore) GetBucket(bucketName string) (*BucketMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bucket, ok := s.buckets[bucketName]
+	if !ok {
+		return nil, nil
+	}
+	return &bucket, nil
+}
+
+func (s *LogStore) PutBucket(bucket BucketMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.appendEntry(logEntry{Op: "put_bucket", Bucket: bucket.Name, Meta: &bucket})
+}
+
+func (s *LogStore) UpdateBucket(bucketName string, update func(*BucketMetadata)) (*BucketMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[bucketName]
+	if !ok {
+		return nil, nil
+	}
+	update(&bucket)
+	return &bucket, s.appendEntry(logEntry{Op: "put_bucket", Bucket: bucket.Name, Meta: &bucket})
+}
+
+func (s *LogStore) DeleteBucket(bucketName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.appendEntry(logEntry{Op: "delete_bucket", Bucket: bucketName})
+}
+
+func (s *LogStore) ListObjects(bucketName string) ([]ObjectMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx := s.objects[bucketName]
+	if idx == nil {
+		return nil, fmt.Errorf("бакет %s не найден в метаданных", bucketName)
+	}
+	return idx.objects(), nil
+}
+
+func (s *LogStore) ListObjectVersions(bucketName string) ([]ObjectMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx := s.objects[bucketName]
+	if idx == nil {
+		return nil, fmt.Errorf("бакет %s не найден в метаданных", bucketName)
+	}
+	return idx.allVersions(), nil
+}
+
+func (s *LogStore) GetObject(bucketName, objectName string) (*ObjectMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx := s.objects[bucketName]
+	if idx == nil {
+		return nil, nil
+	}
+	return idx.current(objectName), nil
+}
+
+func (s *LogStore) GetObjectVersion(bucketName, objectName, versionID string) (*ObjectMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx := s.objects[bucketName]
+	if idx == nil {
+		return nil, nil
+	}
+	return idx.version(objectName, versionID), nil
+}
+
+func (s *LogStore) GetObjectVersions(bucketName, objectName string) ([]ObjectMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx := s.objects[bucketName]
+	if idx == nil {
+		return nil, nil
+	}
+	return idx.keyVersions(objectName), nil
+}
+
+func (s *LogStore) PutObject(bucketName string, object ObjectMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucketName]; !ok {
+		return fmt.Errorf("бакет %s не найден в метаданных", bucketName)
+	}
+	return s.appendEntry(logEntry{Op: "put_object", Bucket: bucketName, Object: &object})
+}
+
+func (s *LogStore) UpdateObject(bucketName string, object ObjectMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.objects[bucketName]
+	if idx == nil || idx.version(object.Key, object.VersionID) == nil {
+		return fmt.Errorf("версия %s объекта %s не найдена", formatVersionID(object.VersionID), object.Key)
+	}
+	return s.appendEntry(logEntry{Op: "update_object", Bucket: bucketName, Object: &object})
+}
+
+func (s *LogStore) DeleteObject(bucketName, objectName, versionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.appendEntry(logEntry{Op: "delete_object", Bucket: bucketName, Key: objectName, VersionID: versionID})
+}
+
+func (s *LogStore) ApplyObjectChanges(bucketName string, changes []ObjectChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucketName]; !ok {
+		return fmt.Errorf("бакет %s не найден в метаданных", bucketName)
+	}
+	entries := make([]logEntry, 0, len(changes))
+	for i := range changes {
+		if changes[i].Delete {
+			object := changes[i].Object
+			entries = append(entries, logEntry{Op: "delete_object", Bucket: bucketName, Key: object.Key, VersionID: object.VersionID})
+		} else {
+			entries = append(entries, logEntry{Op: "put_object", Bucket: bucketName, Object: &changes[i].Object})
+		}
+	}
+	return s.appendEntries(entries)
+}
+
+func (s *LogStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("не удалось сохранить журнал метаданных: %v", err)
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
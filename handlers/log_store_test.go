@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func mustOpenLogStore(t *testing.T, baseDir string) *LogStore {
+	t.Helper()
+	store, err := NewLogStore(baseDir)
+	if err != nil {
+		t.Fatalf("NewLogStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestLogStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	store := mustOpenLogStore(t, dir)
+	if err := store.PutBucket(BucketMetadata{Name: "log-bucket", Versioning: "Enabled"}); err != nil {
+		t.Fatalf("PutBucket: %v", err)
+	}
+	for _, object := range []ObjectMetadata{
+		{Key: "a", VersionID: "v1", Size: 1},
+		{Key: "a", VersionID: "v2", Size: 2},
+		{Key: "b", VersionID: "v3", Size: 3},
+	} {
+		if err := store.PutObject("log-bucket", object); err != nil {
+			t.Fatalf("PutObject: %v", err)
+		}
+	}
+	if err := store.DeleteObject("log-bucket", "b", "v3"); err != nil {
+		t.Fatalf("DeleteObject: %v", err)
+	}
+	if err := store.UpdateObject("log-bucket", ObjectMetadata{Key: "a", VersionID: "v1", Size: 1, Tags: []Tag{{Key: "k", Value: "v"}}}); err != nil {
+		t.Fatalf("UpdateObject: %v", err)
+	}
+	store.Close()
+
+	store = mustOpenLogStore(t, dir)
+	if bucket, _ := store.GetBucket("log-bucket"); bucket == nil || bucket.Versioning != "Enabled" {
+		t.Fatalf("бакет после повторного открытия: %+v", bucket)
+	}
+	versions, _ := store.GetObjectVersions("log-bucket", "a")
+	if len(versions) != 2 || versions[0].VersionID != "v2" || len(versions[1].Tags) != 1 {
+		t.Errorf("версии ключа a: %+v", versions)
+	}
+	if object, _ := store.GetObject("log-bucket", "b"); object != nil {
+		t.Errorf("удалённый объект вернулся: %+v", object)
+	}
+}
+
+func TestLogStoreLoadPartialEntry(t *testing.T) {
+	dir := t.TempDir()
+	store := mustOpenLogStore(t, dir)
+	store.PutBucket(BucketMetadata{Name: "log-bucket"})
+	store.PutObject("log-bucket", ObjectMetadata{Key: "a", Size: 1})
+	store.Close()
+
+	path := filepath.Join(dir, logFileName)
+	complete, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("чтение журнала: %v", err)
+	}
+	if err := os.WriteFile(path, append(complete, `{"op":"put_object","bucket":"log-bu`...), 0o644); err != nil {
+		t.Fatalf("запись журнала: %v", err)
+	}
+
+	store = mustOpenLogStore(t, dir)
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, complete) {
+		t.Fatalf("недописанная запись не отрезана: %q", data)
+	}
+	if err := store.PutObject("log-bucket", ObjectMetadata{Key: "b", Size: 2}); err != nil {
+		t.Fatalf("PutObject после восстановления: %v", err)
+	}
+	store.Close()
+
+	store = mustOpenLogStore(t, dir)
+	objects, _ := store.ListObjects("log-bucket")
+	if len(objects) != 2 {
+		t.Errorf("объекты после повторного открытия: %+v", objects)
+	}
+}
+
+func TestLogStoreLoadCorruptEntry(t *testing.T) {
+	dir := t.TempDir()
+	data := "{\"op\":\"put_bucket\",\"bucket\":\"log-bucket\",\"meta\":{\"Name\":\"log-bucket\"}}\nне json\n"
+	if err := os.WriteFile(filepath.Join(dir, logFileName), []byte(data), 0o644); err != nil {
+		t.Fatalf("запись журнала: %v", err)
+	}
+	if store, err := NewLogStore(dir); err == nil {
+		store.Close()
+		t.Fatal("повреждённая запись в середине журнала принята")
+	}
+}
+
+func TestLogStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+	store := mustOpenLogStore(t, dir)
+	store.PutBucket(BucketMetadata{Name: "log-bucket"})
+	for i := 0; i < 3*minCompactionRecords; i++ {
+		if err := store.PutObject("log-bucket", ObjectMetadata{Key: "key", Size: int64(i)}); err != nil {
+			t.Fatalf("PutObject: %v", err)
+		}
+	}
+	if store.records > 2*minCompactionRecords {
+		t.Errorf("журнал не сжат: %d записей", store.records)
+	}
+	store.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, logFileName))
+	if err != nil {
+		t.Fatalf("чтение журнала: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > 2*minCompactionRecords {
+		t.Errorf("в журнале %d строк", lines)
+	}
+
+	store = mustOpenLogStore(t, dir)
+	object, _ := store.GetObject("log-bucket", "key")
+	if object == nil || object.Size != 3*minCompactionRecords-1 {
+		t.Errorf("после сжатия: %+v", object)
+	}
+}
+
+func TestLogStoreImportCSV(t *testing.T) {
+	dir := t.TempDir()
+	csvStore, err := NewCSVStore(dir)
+	if err != nil {
+		t.Fatalf("NewCSVStore: %v", err)
+	}
+	csvStore.PutBucket(BucketMetadata{Name: "csv-bucket"})
+	for i := 0; i < 3; i++ {
+		csvStore.PutObject("csv-bucket", ObjectMetadata{Key: "key" + strconv.Itoa(i), Size: int64(i)})
+	}
+
+	store := mustOpenLogStore(t, dir)
+	objects, _ := store.ListObjects("csv-bucket")
+	if len(objects) != 3 || objects[2].Key != "key2" {
+		t.Errorf("импортированные объекты: %+v", objects)
+	}
+	if _, err := os.Stat(filepath.Join(dir, logFileName)); err != nil {
+		t.Errorf("журнал не создан: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// MemoryBackend держит содержимое объектов в памяти процесса. Подходит для тестов
+// и временных инсталляций: после перезапуска данные теряются.
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string]memoryObject
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{buckets: make(map[string]map[string]memoryObject)}
+}
+
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error {
+	return nil
+}
+
+func (b *MemoryBackend) MakeBucket(bucketName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.buckets[bucketName] == nil {
+		b.buckets[bucketName] = make(map[string]memoryObject)
+	}
+	return nil
+}
+
+func (b *MemoryBackend) RemoveBucket(bucketName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.buckets, bucketName)
+	return nil
+}
+
+func (b *MemoryBackend) Stage(bucketName, objectName string, r io.Reader) (StagedObject, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryStagedObject{backend: b, bucketName: bucketName, objectName: objectName, data: data}, nil
+}
+
+type memoryStagedObject struct {
+	backend    *MemoryBackend
+	bucketName string
+	objectName string
+	data       []byte
+	previous   *memoryObject
+	committed  bool
+}
+
+func (s *memoryStagedObject) Size() int64 {
+	return int64(len(s.data))
+}
+
+func (s *memoryStagedObject) Commit(object ObjectMetadata) error {
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+
+	bucket := s.backend.buckets[s.bucketName]
+	if bucket == nil {
+		return fmt.Errorf("бакет %s не найден", s.bucketName)
+	}
+	if previous, ok := bucket[s.objectName]; ok {
+		s.previous = &previous
+	}
+	bucket[s.objectName] = memoryObject{data: s.data, modTime: time.Now()}
+	s.committed = true
+	return nil
+}
+
+func (s *memoryStagedObject) Rollback() error {
+	if !s.committed {
+		return nil
+	}
+	s.committed = false
+
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+
+	bucket := s.backend.buckets[s.bucketName]
+	if bucket == nil {
+		return nil
+	}
+	if s.previous != nil {
+		bucket[s.objectName] = *s.previous
+	} else {
+		delete(bucket, s.objectName)
+	}
+	return nil
+}
+
+func (s *memoryStagedObject) Close() error {
+	return nil
+}
+
+func (b *MemoryBackend) Get(bucketName, objectName string) (io.ReadSeekCloser, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	object, ok := b.buckets[bucketName][objectName]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return memoryReader{bytes.NewReader(object.data)}, nil
+}
+
+func (b *MemoryBackend) Stat(bucketName, objectName string) (ObjectInfo, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	object, ok := b.buckets[bucketName][objectName]
+	if !ok {
+		return ObjectInfo{}, os.ErrNotExist
+	}
+	return ObjectInfo{Key: objectName, Size: int64(len(object.data)), ModTime: object.modTime}, nil
+}
+
+func (b *MemoryBackend) Delete(bucketName, objectName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.buckets[bucketName][objectName]; !ok {
+		return os.ErrNotExist
+	}
+	delete(b.buckets[bucketName], objectName)
+	return nil
+}
+
+func (b *MemoryBackend) List(bucketName string, fn func(ObjectInfo) error) error {
+	b.mu.RLock()
+	bucket := b.buckets[bucketName]
+	infos := make([]ObjectInfo, 0, len(bucket))
+	for key, object := range bucket {
+		infos = append(infos, ObjectInfo{Key: key, Size: int64(len(object.data)), ModTime: object.modTime})
+	}
+	b.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	for _, info := range infos {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
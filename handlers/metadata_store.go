@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// MetadataStore хранит метаданные бакетов и объектов.
+// Объект может иметь несколько версий; версия без идентификатора — это null-версия
+// неверсионируемого бакета. Актуальной считается последняя записанная версия ключа.
+// ListObjects возвращает актуальные версии без маркеров удаления, отсортированные по ключу,
+// ListObjectVersions — все версии: по ключу, внутри ключа от новых к старым;
+// GetObjectVersions — так же упорядоченные версии одного ключа.
+// UpdateBucket меняет запись бакета функцией update под замком хранилища, так что
+// одновременные изменения разных полей не затирают друг друга, и возвращает новую запись.
+// Get-методы и UpdateBucket возвращают nil без ошибки, если запись не найдена; GetObject возвращает nil,
+// если актуальная версия — маркер удаления. UpdateObject заменяет существующую версию
+// на месте, не делая её актуальной. ApplyObjectChanges применяет пакет изменений
+// за одну запись метаданных. Close дожидается текущих записей и сбрасывает данные на диск;
+// после него хранилище не используется.
+type MetadataStore interface {
+	ListBuckets() ([]BucketMetadata, error)
+	GetBucket(bucketName string) (*BucketMetadata, error)
+	PutBucket(bucket BucketMetadata) error
+	UpdateBucket(bucketName string, update func(*BucketMetadata)) (*BucketMetadata, error)
+	DeleteBucket(bucketName string) error
+
+	ListObjects(bucketName string) ([]ObjectMetadata, error)
+	ListObjectVersions(bucketName string) ([]ObjectMetadata, error)
+	GetObject(bucketName, objectName string) (*ObjectMetadata, error)
+	GetObjectVersion(bucketName, objectName, versionID string) (*ObjectMetadata, error)
+	GetObjectVersions(bucketName, objectName string) ([]ObjectMetadata, error)
+	PutObject(bucketName string, object ObjectMetadata) error
+	UpdateObject(bucketName string, object ObjectMetadata) error
+	DeleteObject(bucketName, objectName, versionID string) error
+	ApplyObjectChanges(bucketName string, changes []ObjectChange) error
+
+	Close() error
+}
+
+// ObjectChange — одно изменение пакета: запись версии Object или, если Delete,
+// удаление версии Object.Key с идентификатором Object.VersionID.
+type ObjectChange struct {
+	Object ObjectMetadata
+	Delete bool
+}
+
+var Store MetadataStore
+
+type BucketMetadata struct {
+	Name         string
+	CreationTime string
+	LastModified string
+	Status       string
+	Versioning   string
+}
+
+type ObjectMetadata struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified string
+	StoredETag   string
+	VersionID    string
+	DeleteMarker bool
+	ObjectEncryption
+	ObjectHeaders
+	Tags []Tag
+}
+
+func (m ObjectMetadata) LastModifiedTime() time.Time {
+	t, err := time.Parse(time.RFC3339, m.LastModified)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
+
+// ETag возвращает MD5 содержимого. Для объектов, загруженных до появления колонки ETag,
+// он строится из времени изменения и размера.
+func (m ObjectMetadata) ETag() string {
+	if m.StoredETag != "" {
+		return "\"" + m.StoredETag + "\""
+	}
+	return fmt.Sprintf("\"%x-%x\"", m.LastModifiedTime().Unix(), m.Size)
+}
+
+// objectIndex хранит версии объектов бакета: ключи отсортированы,
+// версии каждого ключа лежат в порядке записи, последняя — актуальная.
+type objectIndex struct {
+	keys     []string
+	versions map[string][]ObjectMetadata
+}
+
+func newObjectIndex() *objectIndex {
+	return &objectIndex{versions: make(map[string][]ObjectMetadata)}
+}
+
+// put добавляет версию и делает её актуальной. Версия с тем же идентификатором заменяется.
+func (idx *objectIndex) put(object ObjectMetadata) {
+	versions, ok := idx.versions[object.Key]
+	if !ok {
+		pos := sort.SearchStrings(idx.keys, object.Key)
+		idx.keys = append(idx.keys, "")
+		copy(idx.keys[pos+1:], idx.keys[pos:])
+		idx.keys[pos] = object.Key
+	}
+	idx.versions[object.Key] = append(removeVersion(versions, object.VersionID), object)
+}
+
+// update заменяет версию на месте. Возвращает false, если такой версии нет.
+func (idx *objectIndex) update(object ObjectMetadata) bool {
+	versions := idx.versions[object.Key]
+	for i := range versions {
+		if versions[i].VersionID == object.VersionID {
+			versions[i] = object
+			return true
+		}
+	}
+	return false
+}
+
+func (idx *objectIndex) remove(key, versionID string) {
+	versions, ok := idx.versions[key]
+	if !ok {
+		return
+	}
+	versions = removeVersion(versions, versionID)
+	if len(versions) > 0 {
+		idx.versions[key] = versions
+		return
+	}
+	delete(idx.versions, key)
+	pos := sort.SearchStrings(idx.keys, key)
+	idx.keys = append(idx.keys[:pos], idx.keys[pos+1:]...)
+}
+
+func removeVersion(versions []ObjectMetadata, versionID string) []ObjectMetadata {
+	kept := make([]ObjectMetadata, 0, len(versions))
+	for _, version := range versions {
+		if version.VersionID != versionID {
+			kept = append(kept, version)
+		}
+	}
+	return kept
+}
+
+func (idx *objectIndex) apply(changes []ObjectChange) {
+	for _, change := range changes {
+		if change.Delete {
+			idx.remove(change.Object.Key, change.Object.VersionID)
+		} else {
+			idx.put(change.Object)
+		}
+	}
+}
+
+func (idx *objectIndex) current(key string) *ObjectMetadata {
+	versions := idx.versions[key]
+	if len(versions) == 0 || versions[len(versions)-1].DeleteMarker {
+		return nil
+	}
+	object := versions[len(versions)-1]
+	return &object
+}
+
+func (idx *objectIndex) version(key, versionID string) *ObjectMetadata {
+	for _, version := range idx.versions[key] {
+		if version.VersionID == versionID {
+			return &version
+		}
+	}
+	return nil
+}
+
+func (idx *objectIndex) objects() []ObjectMetadata {
+	objects := make([]ObjectMetadata, 0, len(idx.keys))
+	for _, key := range idx.keys {
+		if object := idx.current(key); object != nil {
+			objects = append(objects, *object)
+		}
+	}
+	return objects
+}
+
+func (idx *objectIndex) allVersions() []ObjectMetadata {
+	var all []ObjectMetadata
+	for _, key := range idx.keys {
+		all = append(all, idx.keyVersions(key)...)
+	}
+	return all
+}
+
+// keyVersions возвращает версии ключа от новых к старым.
+func (idx *objectIndex) keyVersions(key string) []ObjectMetadata {
+	versions := idx.versions[key]
+	newest := make([]ObjectMetadata, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		newest = append(newest, versions[i])
+	}
+	return newest
+}
+
+// records возвращает версии в порядке хранения: по ключу, внутри ключа от старых к новым.
+func (idx *objectIndex) records() []ObjectMetadata {
+	var records []ObjectMetadata
+	for _, key := range idx.keys {
+		records = append(records, idx.versions[key]...)
+	}
+	return records
+}
+
+func (idx *objectIndex) size() int {
+	n := 0
+	for _, versions := range idx.versions {
+		n += len(versions)
+	}
+	return n
+}
+
+// DetectMetadataStore определяет, каким хранилищем метаданных записана директория данных.
+// Журнал, раз появившись, главнее CSV: после импорта buckets.csv и objects.csv больше не обновляются.
+func DetectMetadataStore(baseDir string) string {
+	if _, err := os.Stat(filepath.Join(baseDir, logFileName)); err == nil {
+		return "log"
+	}
+	return "csv"
+}
+
+// NewMetadataStore создаёт хранилище метаданных выбранного типа: csv или log.
+func NewMetadataStore(kind, baseDir string) (MetadataStore, error) {
+	switch kind {
+	case "csv":
+		return NewCSVStore(baseDir)
+	case "log":
+		return NewLogStore(baseDir)
+	default:
+		return nil, fmt.Errorf("неизвестный тип хранилища метаданных: %s", kind)
+	}
+}
+
+func isBucketInMetadata(bucketName string) (bool, error) {
+	bucket, err := Store.GetBucket(bucketName)
+	return bucket != nil, err
+}
+
+// isBucketEmpty смотрит в метаданные: данные объектов могут лежать не на диске.
+// Бакет с оставшимися старыми версиями или маркерами удаления пустым не считается.
+func isBucketEmpty(bucketName string) (bool, error) {
+	objects, err := Store.ListObjectVersions(bucketName)
+	if err != nil {
+		return false, err
+	}
+	return len(objects) == 0, nil
+}
+
+func UpdateBucketStatus(bucketName string) error {
+	empty, err := isBucketEmpty(bucketName)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать содержимое бакета: %v", err)
+	}
+
+	bucket, err := Store.UpdateBucket(bucketName, func(bucket *BucketMetadata) {
+		bucket.Status = "Inactive"
+		if !empty {
+			bucket.Status = "Active"
+		}
+		bucket.LastModified = time.Now().UTC().Format(time.RFC3339)
+	})
+	if err != nil {
+		return err
+	}
+	if bucket == nil {
+		return fmt.Errorf("бакет %s не найден в метаданных", bucketName)
+	}
+	return nil
+}
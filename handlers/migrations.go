@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// schemaFileName хранит номер схемы данных. Директория без него считается созданной
+// до появления миграций, то есть схемой 0.
+const schemaFileName = "schema.version"
+
+// migration переводит директорию данных со схемы version-1 на схему version.
+// apply должен быть идемпотентным: сбой между ним и записью номера схемы повторит его при следующем запуске.
+type migration struct {
+	version     int
+	description string
+	apply       func(m *migrator) error
+}
+
+var migrations = []migration{
+	{1, "дополнить buckets.csv и objects.csv колонками текущей схемы", migrateFullCSVHeaders},
+}
+
+// CurrentSchemaVersion — схема, которую пишет и ожидает эта версия сервера.
+var CurrentSchemaVersion = migrations[len(migrations)-1].version
+
+type migrator struct {
+	baseDir string
+	dryRun  bool
+	logger  *log.Logger
+}
+
+// MigrationStatus описывает состояние схемы директории данных.
+type MigrationStatus struct {
+	Version int
+	Pending int
+}
+
+// ReadSchemaVersion возвращает номер схемы директории данных. Пустая директория получает
+// текущую схему сразу, без миграций: старых файлов в ней нет.
+func ReadSchemaVersion(baseDir string) (MigrationStatus, error) {
+	data, err := os.ReadFile(filepath.Join(baseDir, schemaFileName))
+	if os.IsNotExist(err) {
+		if isFreshDataDir(baseDir) {
+			return MigrationStatus{Version: CurrentSchemaVersion}, nil
+		}
+		return MigrationStatus{Pending: len(migrations)}, nil
+	} else if err != nil {
+		return MigrationStatus{}, fmt.Errorf("не удалось прочитать версию схемы данных: %v", err)
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || version < 0 {
+		return MigrationStatus{}, fmt.Errorf("некорректная версия схемы данных в %s: %q", schemaFileName, strings.TrimSpace(string(data)))
+	}
+	if version > CurrentSchemaVersion {
+		return MigrationStatus{}, fmt.Errorf("схема данных версии %d новее поддерживаемой %d, обновите сервер", version, CurrentSchemaVersion)
+	}
+
+	status := MigrationStatus{Version: version}
+	for _, m := range migrations {
+		if m.version > version {
+			status.Pending++
+		}
+	}
+	return status, nil
+}
+
+// MigrateDataDir по очереди применяет недостающие миграции, записывая номер схемы после каждой.
+// В режиме dryRun только описывает изменения. Вызывается до открытия Store.
+func MigrateDataDir(baseDir string, dryRun bool, logger *log.Logger) (int, error) {
+	status, err := ReadSchemaVersion(baseDir)
+	if err != nil {
+		return 0, err
+	}
+
+	m := &migrator{baseDir: baseDir, dryRun: dryRun, logger: logger}
+	applied := 0
+	for _, step := range migrations {
+		if step.version <= status.Version {
+			continue
+		}
+		logger.Printf("Миграция %d: %s", step.version, step.description)
+		if err := step.apply(m); err != nil {
+			return applied, fmt.Errorf("миграция %d не выполнена: %v", step.version, err)
+		}
+		if !dryRun {
+			if err := writeSchemaVersion(baseDir, step.version); err != nil {
+				return applied, err
+			}
+		}
+		applied++
+	}
+
+	if applied == 0 && !dryRun {
+		if _, err := os.Stat(filepath.Join(baseDir, schemaFileName)); os.IsNotExist(err) {
+			return 0, writeSchemaVersion(baseDir, status.Version)
+		}
+	}
+	return applied, nil
+}
+
+func writeSchemaVersion(baseDir string, version int) error {
+	err := writeFileAtomic(filepath.Join(baseDir, schemaFileName), baseDir, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("не удалось записать версию схемы данных: %v", err)
+	}
+	return nil
+}
+
+func isFreshDataDir(baseDir string) bool {
+	for _, name := range []string{"buckets.csv", logFileName} {
+		if _, err := os.Stat(filepath.Join(baseDir, name)); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// rewriteCSV заменяет заголовок файла на header и пропускает каждую строку через convert.
+// Файл переписывается атомарно и только если что-то меняется.
+func (m *migrator) rewriteCSV(path, tempDir string, header []string, convert func([]string) []string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать %s: %v", path, err)
+	}
+
+	changed := len(records) == 0 || !slices.Equal(records[0], header)
+	rows := make([][]string, 0, len(records))
+	for i, record := range records {
+		if i == 0 || len(record) == 0 {
+			continue
+		}
+		row := convert(append([]string(nil), record...))
+		if !slices.Equal(row, record) {
+			changed = true
+		}
+		rows = append(rows, row)
+	}
+	if !changed {
+		return nil
+	}
+
+	if m.dryRun {
+		m.logger.Printf("  %s будет переписан: колонок %d, строк %d", path, len(header), len(rows))
+		return nil
+	}
+	err = writeFileAtomic(path, tempDir, func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		writer.Write(header)
+		writer.WriteAll(rows)
+		return writer.Error()
+	})
+	if err != nil {
+		return fmt.Errorf("не удалось переписать %s: %v", path, err)
+	}
+	m.logger.Printf("  %s переписан: колонок %d, строк %d", path, len(header), len(rows))
+	return nil
+}
+
+// migrateFullCSVHeaders переводит файлы, записанные до появления новых колонок, на полный
+// заголовок. Сервер и так дополняет такие строки при чтении, но теперь файлы становятся
+// однородными и следующая миграция может рассчитывать на все колонки.
+func migrateFullCSVHeaders(m *migrator) error {
+	bucketsPath := filepath.Join(m.baseDir, "buckets.csv")
+	var bucketNames []string
+	err := m.rewriteCSV(bucketsPath, m.baseDir, bucketsCSVHeader, func(record []string) []string {
+		bucketNames = append(bucketNames, record[0])
+		return padRecord(record, len(bucketsCSVHeader))
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, bucketName := range bucketNames {
+		objectsPath := filepath.Join(m.baseDir, bucketName, "objects.csv")
+		if _, err := os.Stat(objectsPath); os.IsNotExist(err) {
+			continue
+		}
+		tempDir := filepath.Join(m.baseDir, bucketName, systemDirName)
+		if !m.dryRun {
+			if err := os.MkdirAll(tempDir, 0o755); err != nil {
+				return fmt.Errorf("не удалось создать служебную директорию бакета: %v", err)
+			}
+		}
+		err := m.rewriteCSV(objectsPath, tempDir, objectsCSVHeader, func(record []string) []string {
+			return padRecord(record, len(objectsCSVHeader))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
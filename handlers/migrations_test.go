@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// writeLegacyDataDir создаёт директорию данных в формате до появления миграций:
+// короткие заголовки и строки без новых колонок.
+func writeLegacyDataDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"buckets.csv":            "Name,CreationTime,LastModified,Status\nold-bucket,2023-01-01T00:00:00Z,2023-01-01T00:00:00Z,Active\n",
+		"old-bucket/objects.csv": "ObjectName,Size,ContentType,LastModified\nreport.txt,5,text/plain,2023-01-02T00:00:00Z\n",
+		"old-bucket/report.txt":  "hello",
+		"orphan-dir/objects.csv": "ObjectName,Size,ContentType,LastModified\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func readCSVFile(t *testing.T, path string) [][]string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return records
+}
+
+func TestMigrateLegacyDataDir(t *testing.T) {
+	dir := writeLegacyDataDir(t)
+	logger := log.New(io.Discard, "", 0)
+	bucketsPath := filepath.Join(dir, "buckets.csv")
+	objectsPath := filepath.Join(dir, "old-bucket", "objects.csv")
+
+	status, err := ReadSchemaVersion(dir)
+	if err != nil || status != (MigrationStatus{Version: 0, Pending: len(migrations)}) {
+		t.Fatalf("ReadSchemaVersion: %+v, %v", status, err)
+	}
+
+	before, _ := os.ReadFile(bucketsPath)
+	if applied, err := MigrateDataDir(dir, true, logger); err != nil || applied != len(migrations) {
+		t.Fatalf("пробный запуск: %d, %v", applied, err)
+	}
+	if after, _ := os.ReadFile(bucketsPath); string(after) != string(before) {
+		t.Error("пробный запуск изменил buckets.csv")
+	}
+	if _, err := os.Stat(filepath.Join(dir, schemaFileName)); !os.IsNotExist(err) {
+		t.Errorf("пробный запуск записал версию схемы: %v", err)
+	}
+
+	if applied, err := MigrateDataDir(dir, false, logger); err != nil || applied != len(migrations) {
+		t.Fatalf("миграция: %d, %v", applied, err)
+	}
+	buckets := readCSVFile(t, bucketsPath)
+	if !slices.Equal(buckets[0], bucketsCSVHeader) || len(buckets) != 2 || len(buckets[1]) != len(bucketsCSVHeader) {
+		t.Errorf("buckets.csv после миграции: %q", buckets)
+	}
+	objects := readCSVFile(t, objectsPath)
+	if !slices.Equal(objects[0], objectsCSVHeader) || len(objects) != 2 || len(objects[1]) != len(objectsCSVHeader) {
+		t.Errorf("objects.csv после миграции: %q", objects)
+	}
+	if header := readCSVFile(t, filepath.Join(dir, "orphan-dir", "objects.csv"))[0]; len(header) != 4 {
+		t.Errorf("objects.csv директории без бакета изменён: %q", header)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, schemaFileName))
+	if string(data) != strconv.Itoa(CurrentSchemaVersion)+"\n" {
+		t.Errorf("версия схемы %q", data)
+	}
+
+	// Повторный запуск ничего не меняет.
+	migrated, _ := os.ReadFile(objectsPath)
+	if applied, err := MigrateDataDir(dir, false, logger); err != nil || applied != 0 {
+		t.Errorf("повторная миграция: %d, %v", applied, err)
+	}
+	if again, _ := os.ReadFile(objectsPath); string(again) != string(migrated) {
+		t.Error("повторная миграция переписала objects.csv")
+	}
+
+	store, err := NewCSVStore(dir)
+	if err != nil {
+		t.Fatalf("NewCSVStore: %v", err)
+	}
+	object, err := store.GetObject("old-bucket", "report.txt")
+	if err != nil || object == nil || object.Size != 5 || object.ContentType != "text/plain" {
+		t.Errorf("объект после миграции: %+v, %v", object, err)
+	}
+}
+
+func TestReadSchemaVersion(t *testing.T) {
+	fresh := t.TempDir()
+	if status, err := ReadSchemaVersion(fresh); err != nil || status != (MigrationStatus{Version: CurrentSchemaVersion}) {
+		t.Errorf("пустая директория: %+v, %v", status, err)
+	}
+	if applied, err := MigrateDataDir(fresh, false, log.New(io.Discard, "", 0)); err != nil || applied != 0 {
+		t.Errorf("миграция пустой директории: %d, %v", applied, err)
+	}
+	if _, err := os.Stat(filepath.Join(fresh, schemaFileName)); err != nil {
+		t.Errorf("версия схемы не записана: %v", err)
+	}
+
+	for _, value := range []string{strconv.Itoa(CurrentSchemaVersion + 1), "abc", "-1"} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, schemaFileName), []byte(value+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadSchemaVersion(dir); err == nil {
+			t.Errorf("версия схемы %q принята", value)
+		}
+	}
+}
@@ -0,0 +1,806 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minPartSize   = 5 << 20
+	maxPartNumber = 10000
+	maxListParts  = 1000
+)
+
+type MultipartUpload struct {
+	UploadID    string
+	Key         string
+	ContentType string
+	Initiated   string
+	ObjectHeaders
+	Tags []Tag
+	// Encryption и CustomerKeyMD5 задаются при создании загрузки; каждая часть шифруется
+	// своим ключом данных, запечатанным в SealedKey части.
+	Encryption     string
+	CustomerKeyMD5 string
+}
+
+// UploadedPart.Size — размер открытого содержимого части.
+type UploadedPart struct {
+	PartNumber   int
+	ETag         string
+	Size         int64
+	LastModified string
+	SealedKey    string
+}
+
+type InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type CompletePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type CompleteMultipartUpload struct {
+	XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+	Parts   []CompletePart `xml:"Part"`
+}
+
+type CompleteMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+type PartInfo struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+}
+
+type ListPartsResult struct {
+	XMLName              xml.Name   `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListPartsResult"`
+	Bucket               string     `xml:"Bucket"`
+	Key                  string     `xml:"Key"`
+	UploadID             string     `xml:"UploadId"`
+	PartNumberMarker     int        `xml:"PartNumberMarker"`
+	NextPartNumberMarker int        `xml:"NextPartNumberMarker"`
+	MaxParts             int        `xml:"MaxParts"`
+	IsTruncated          bool       `xml:"IsTruncated"`
+	StorageClass         string     `xml:"StorageClass"`
+	Parts                []PartInfo `xml:"Part"`
+}
+
+type UploadInfo struct {
+	Key          string `xml:"Key"`
+	UploadID     string `xml:"UploadId"`
+	Initiated    string `xml:"Initiated"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type ListMultipartUploadsResult struct {
+	XMLName     xml.Name     `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListMultipartUploadsResult"`
+	Bucket      string       `xml:"Bucket"`
+	Prefix      string       `xml:"Prefix"`
+	IsTruncated bool         `xml:"IsTruncated"`
+	Uploads     []UploadInfo `xml:"Upload"`
+}
+
+func multipartDir(bucketName string) string {
+	return filepath.Join(BaseDir, bucketName, systemDirName, "multipart")
+}
+
+func uploadDir(bucketName, uploadID string) string {
+	return filepath.Join(multipartDir(bucketName), uploadID)
+}
+
+func partFileName(partNumber int) string {
+	return fmt.Sprintf("part-%05d", partNumber)
+}
+
+func newUploadID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func isValidUploadID(uploadID string) bool {
+	if len(uploadID) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(uploadID)
+	return err == nil
+}
+
+func writeXMLResult(w http.ResponseWriter, statusCode int, result interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(statusCode)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(result)
+}
+
+func parseObjectPath(path string) (string, string, bool) {
+	pathSegments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(pathSegments) < 2 {
+		return "", "", false
+	}
+	return pathSegments[0], strings.Join(pathSegments[1:], "/"), true
+}
+
+func readMultipartUpload(bucketName, uploadID string) (*MultipartUpload, error) {
+	file, err := os.Open(filepath.Join(uploadDir(bucketName, uploadID), "upload.csv"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать upload.csv: %v", err)
+	}
+	if len(records) < 2 || len(records[1]) < 3 {
+		return nil, fmt.Errorf("повреждён файл upload.csv загрузки %s", uploadID)
+	}
+	record := padRecord(records[1], 6+len(objectHeadersColumns))
+	return &MultipartUpload{
+		UploadID:       uploadID,
+		Key:            record[0],
+		ContentType:    record[1],
+		Initiated:      record[2],
+		ObjectHeaders:  recordToHeaders(record[3 : 3+len(objectHeadersColumns)]),
+		Tags:           decodeTags(record[3+len(objectHeadersColumns)]),
+		Encryption:     record[4+len(objectHeadersColumns)],
+		CustomerKeyMD5: record[5+len(objectHeadersColumns)],
+	}, nil
+}
+
+func readUploadedParts(bucketName, uploadID string) ([]UploadedPart, error) {
+	file, err := os.Open(filepath.Join(uploadDir(bucketName, uploadID), "parts.csv"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("не удалось открыть parts.csv: %v", err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать parts.csv: %v", err)
+	}
+
+	var parts []UploadedPart
+	for i, record := range records {
+		if i == 0 || len(record) < 4 {
+			continue
+		}
+		record = padRecord(record, 5)
+		partNumber, err := strconv.Atoi(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("некорректный номер части %s: %v", record[0], err)
+		}
+		size, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный размер части %s: %v", record[0], err)
+		}
+		parts = append(parts, UploadedPart{PartNumber: partNumber, ETag: record[1], Size: size, LastModified: record[3], SealedKey: record[4]})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+func writeUploadedParts(bucketName, uploadID string, parts []UploadedPart) error {
+	dir := uploadDir(bucketName, uploadID)
+	err := writeFileAtomic(filepath.Join(dir, "parts.csv"), dir, func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"PartNumber", "ETag", "Size", "LastModified", "SealedKey"})
+		for _, part := range parts {
+			writer.Write([]string{strconv.Itoa(part.PartNumber), part.ETag, strconv.FormatInt(part.Size, 10), part.LastModified, part.SealedKey})
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return fmt.Errorf("не удалось записать parts.csv: %v", err)
+	}
+	return nil
+}
+
+// lookupUpload проверяет бакет и загрузку и пишет ошибку в ответ, если что-то не так.
+func lookupUpload(w http.ResponseWriter, r *http.Request, bucketName, objectName, uploadID string) *MultipartUpload {
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return nil
+	}
+	if !exists {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return nil
+	}
+	if !isValidUploadID(uploadID) {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchUpload", "Загрузка не найдена")
+		return nil
+	}
+
+	upload, err := readMultipartUpload(bucketName, uploadID)
+	if os.IsNotExist(err) {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchUpload", "Загрузка не найдена")
+		return nil
+	} else if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения метаданных загрузки")
+		return nil
+	}
+	if upload.Key != objectName {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchUpload", "Загрузка не найдена")
+		return nil
+	}
+	return upload
+}
+
+func CreateMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName, objectName, ok := parseObjectPath(r.URL.Path)
+	if !ok {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Неверный путь. Ожидалось /{bucketName}/{objectName}")
+		return
+	}
+
+	if isReservedObjectName(objectName) {
+		WriteS3Error(w, r, http.StatusForbidden, "AccessDenied", "Перезапись служебных файлов бакета запрещена")
+		return
+	}
+
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if !exists {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	encryption, ok := requestEncryption(w, r)
+	if !ok {
+		return
+	}
+
+	headers, ok := requestObjectHeaders(w, r)
+	if !ok {
+		return
+	}
+
+	tags, ok := requestTagging(w, r)
+	if !ok {
+		return
+	}
+
+	uploadID, err := newUploadID()
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка генерации идентификатора загрузки")
+		return
+	}
+
+	dir := uploadDir(bucketName, uploadID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка создания директории загрузки")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	err = writeFileAtomic(filepath.Join(dir, "upload.csv"), dir, func(out io.Writer) error {
+		writer := csv.NewWriter(out)
+		writer.Write(append(append([]string{"Key", "ContentType", "Initiated"}, objectHeadersColumns...), "Tags", "Encryption", "CustomerKeyMD5"))
+		writer.Write(append(append([]string{objectName, contentType, time.Now().UTC().Format(time.RFC3339)}, headersToRecord(headers)...), encodeTags(tags), encryption.mode, encryption.customerKeyMD5))
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка записи метаданных загрузки")
+		return
+	}
+
+	setEncryptionHeaders(w, ObjectEncryption{Encryption: encryption.mode, CustomerKeyMD5: encryption.customerKeyMD5})
+	writeXMLResult(w, http.StatusOK, InitiateMultipartUploadResult{Bucket: bucketName, Key: objectName, UploadID: uploadID})
+}
+
+// uploadEncryption восстанавливает шифрование загрузки для приёма частей и сборки.
+// Ключ SSE-C клиент повторяет в каждом запросе. При ошибке пишет ответ сам и возвращает false.
+func uploadEncryption(w http.ResponseWriter, r *http.Request, upload *MultipartUpload) (*encryptionRequest, bool) {
+	key, keyMD5, err := customerKey(r.Header, sseCustomerHeaders)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return nil, false
+	}
+
+	switch upload.Encryption {
+	case "":
+		if key != nil {
+			WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Загрузка не зашифрована ключом клиента")
+			return nil, false
+		}
+		return &encryptionRequest{}, true
+	case sseS3:
+		if masterKey == nil {
+			WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Загрузка зашифрована SSE-S3, но мастер-ключ не загружен")
+			return nil, false
+		}
+		return &encryptionRequest{mode: sseS3, kek: masterKey}, true
+	case sseC:
+		if key == nil {
+			WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Загрузка зашифрована ключом клиента, укажите заголовки SSE-C")
+			return nil, false
+		}
+		if subtle.ConstantTimeCompare([]byte(keyMD5), []byte(upload.CustomerKeyMD5)) != 1 {
+			WriteS3Error(w, r, http.StatusForbidden, "AccessDenied", "Ключ клиента не совпадает с ключом загрузки")
+			return nil, false
+		}
+		return &encryptionRequest{mode: sseC, kek: key, customerKeyMD5: keyMD5}, true
+	default:
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Неизвестный режим шифрования загрузки")
+		return nil, false
+	}
+}
+
+func UploadPartHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName, objectName, ok := parseObjectPath(r.URL.Path)
+	if !ok {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Неверный путь. Ожидалось /{bucketName}/{objectName}")
+		return
+	}
+
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Номер части должен быть от 1 до 10000")
+		return
+	}
+
+	upload := lookupUpload(w, r, bucketName, objectName, uploadID)
+	if upload == nil {
+		return
+	}
+	encryption, ok := uploadEncryption(w, r, upload)
+	if !ok {
+		return
+	}
+
+	expectedMD5, ok := parseContentMD5(r.Header.Get("Content-MD5"))
+	if !ok {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidDigest", "Некорректный заголовок Content-MD5")
+		return
+	}
+
+	part, err := savePart(bucketName, uploadID, partNumber, r.Body, expectedMD5, encryption)
+	if err != nil {
+		writePartError(w, r, err)
+		return
+	}
+
+	setEncryptionHeaders(w, ObjectEncryption{Encryption: upload.Encryption, CustomerKeyMD5: upload.CustomerKeyMD5})
+	w.Header().Set("ETag", part.ETag)
+	w.WriteHeader(http.StatusOK)
+}
+
+var errNoSuchUpload = errors.New("загрузка не найдена")
+
+// savePart сохраняет содержимое части и обновляет список частей загрузки. Часть зашифрованной
+// загрузки шифруется собственным ключом данных: номера частей можно загружать повторно,
+// и общий ключ привёл бы к повтору nonce.
+func savePart(bucketName, uploadID string, partNumber int, data io.Reader, expectedMD5 []byte, encryption *encryptionRequest) (UploadedPart, error) {
+	dir := uploadDir(bucketName, uploadID)
+	tempFile, err := os.CreateTemp(dir, partFileName(partNumber)+".*.tmp")
+	if err != nil {
+		return UploadedPart{}, err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	body := &digestReader{reader: data, hash: md5.New()}
+	encrypted, partEncryption, err := encryption.encrypt(body)
+	if err != nil {
+		return UploadedPart{}, err
+	}
+	if _, err := io.Copy(tempFile, encrypted); err != nil {
+		return UploadedPart{}, err
+	}
+	if err := tempFile.Sync(); err != nil {
+		return UploadedPart{}, err
+	}
+	if err := tempFile.Close(); err != nil {
+		return UploadedPart{}, err
+	}
+	sum := body.hash.Sum(nil)
+	if expectedMD5 != nil && !bytes.Equal(expectedMD5, sum) {
+		return UploadedPart{}, errBadDigest
+	}
+
+	defer lockUpload(bucketName, uploadID)()
+
+	// Загрузку могли отменить, пока принимались данные.
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return UploadedPart{}, errNoSuchUpload
+	}
+
+	if err := os.Rename(tempFile.Name(), filepath.Join(dir, partFileName(partNumber))); err != nil {
+		return UploadedPart{}, err
+	}
+
+	parts, err := readUploadedParts(bucketName, uploadID)
+	if err != nil {
+		return UploadedPart{}, err
+	}
+
+	part := UploadedPart{PartNumber: partNumber, ETag: fmt.Sprintf("\"%x\"", sum), Size: body.size, LastModified: time.Now().UTC().Format(time.RFC3339), SealedKey: partEncryption.SealedKey}
+	replaced := false
+	for i := range parts {
+		if parts[i].PartNumber == partNumber {
+			parts[i] = part
+			replaced = true
+		}
+	}
+	if !replaced {
+		parts = append(parts, part)
+	}
+
+	return part, writeUploadedParts(bucketName, uploadID, parts)
+}
+
+// writePartError отвечает клиенту на ошибку savePart.
+func writePartError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case writePayloadError(w, r, err):
+	case errors.Is(err, errBadDigest):
+		WriteS3Error(w, r, http.StatusBadRequest, "BadDigest", "Content-MD5 не совпадает с содержимым части")
+	case errors.Is(err, errNoSuchUpload):
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchUpload", "Загрузка не найдена")
+	default:
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка сохранения части")
+	}
+}
+
+func CompleteMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName, objectName, ok := parseObjectPath(r.URL.Path)
+	if !ok {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Неверный путь. Ожидалось /{bucketName}/{objectName}")
+		return
+	}
+
+	uploadID := r.URL.Query().Get("uploadId")
+	upload := lookupUpload(w, r, bucketName, objectName, uploadID)
+	if upload == nil {
+		return
+	}
+	encryption, ok := uploadEncryption(w, r, upload)
+	if !ok {
+		return
+	}
+
+	var request CompleteMultipartUpload
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Parts) == 0 {
+		WriteS3Error(w, r, http.StatusBadRequest, "MalformedXML", "Некорректный XML запроса CompleteMultipartUpload")
+		return
+	}
+
+	// Замок загрузки держится всю сборку: части не должны меняться, пока из них собирается объект.
+	// Другие загрузки при этом не ждут.
+	defer lockUpload(bucketName, uploadID)()
+
+	dir := uploadDir(bucketName, uploadID)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchUpload", "Загрузка не найдена")
+		return
+	}
+	parts, err := readUploadedParts(bucketName, uploadID)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения списка частей")
+		return
+	}
+	uploaded := make(map[int]UploadedPart, len(parts))
+	for _, part := range parts {
+		uploaded[part.PartNumber] = part
+	}
+
+	hash := md5.New()
+	selected := make([]UploadedPart, 0, len(request.Parts))
+	for i, requested := range request.Parts {
+		if i > 0 && requested.PartNumber <= request.Parts[i-1].PartNumber {
+			WriteS3Error(w, r, http.StatusBadRequest, "InvalidPartOrder", "Части должны быть перечислены по возрастанию номеров")
+			return
+		}
+		part, ok := uploaded[requested.PartNumber]
+		if !ok || strings.Trim(requested.ETag, "\"") != strings.Trim(part.ETag, "\"") {
+			WriteS3Error(w, r, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("Часть %d не найдена или её ETag не совпадает", requested.PartNumber))
+			return
+		}
+		if i < len(request.Parts)-1 && part.Size < minPartSize {
+			WriteS3Error(w, r, http.StatusBadRequest, "EntityTooSmall", fmt.Sprintf("Часть %d меньше минимального размера 5 МБ", requested.PartNumber))
+			return
+		}
+		sum, _ := hex.DecodeString(strings.Trim(part.ETag, "\""))
+		hash.Write(sum)
+		selected = append(selected, part)
+	}
+
+	// Части зашифрованной загрузки расшифровываются и весь объект шифруется заново одним
+	// ключом данных, как при обычной загрузке, чтобы его можно было читать с любого места.
+	var size int64
+	readers := make([]io.Reader, 0, len(selected))
+	for _, part := range selected {
+		partFile, err := os.Open(filepath.Join(dir, partFileName(part.PartNumber)))
+		if err != nil {
+			WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения части")
+			return
+		}
+		defer partFile.Close()
+		size += part.Size
+
+		if upload.Encryption == "" {
+			readers = append(readers, partFile)
+			continue
+		}
+		dataKey, err := openKey(encryption.kek, part.SealedKey)
+		if err != nil {
+			WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Не удалось расшифровать ключ данных части")
+			return
+		}
+		decrypted, err := newDecryptReader(partFile, dataKey, part.Size)
+		if err != nil {
+			WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения части")
+			return
+		}
+		readers = append(readers, decrypted)
+	}
+	data, objectEncryption, err := encryption.encrypt(io.MultiReader(readers...))
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка подготовки шифрования объекта")
+		return
+	}
+
+	bucket, err := Store.GetBucket(bucketName)
+	if err != nil || bucket == nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	versionID, err := nextVersionID(bucket)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Не удалось создать идентификатор версии")
+		return
+	}
+
+	staged, err := ObjectBackend.Stage(bucketName, versionDataName(objectName, versionID), data)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка сборки объекта")
+		return
+	}
+
+	defer lockObject(bucketName, objectName)()
+	defer staged.Close()
+
+	etag := fmt.Sprintf("%x-%d", hash.Sum(nil), len(selected))
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	object := ObjectMetadata{Key: objectName, Size: size, ContentType: upload.ContentType, LastModified: timestamp, StoredETag: etag, VersionID: versionID, ObjectEncryption: objectEncryption, ObjectHeaders: upload.ObjectHeaders, Tags: upload.Tags}
+	if err := staged.Commit(object); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка сборки объекта")
+		return
+	}
+	if err := Store.PutObject(bucketName, object); err != nil {
+		staged.Rollback()
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка обновления метаданных объекта")
+		return
+	}
+
+	os.RemoveAll(dir)
+
+	if err := UpdateBucketStatus(bucketName); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка обновления статуса бакета")
+		return
+	}
+
+	if bucket.Versioning != "" {
+		w.Header().Set("x-amz-version-id", formatVersionID(versionID))
+	}
+	setEncryptionHeaders(w, objectEncryption)
+	writeXMLResult(w, http.StatusOK, CompleteMultipartUploadResult{
+		Location: "/" + bucketName + "/" + objectName,
+		Bucket:   bucketName,
+		Key:      objectName,
+		ETag:     "\"" + etag + "\"",
+	})
+}
+
+func AbortMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName, objectName, ok := parseObjectPath(r.URL.Path)
+	if !ok {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Неверный путь. Ожидалось /{bucketName}/{objectName}")
+		return
+	}
+
+	uploadID := r.URL.Query().Get("uploadId")
+	if lookupUpload(w, r, bucketName, objectName, uploadID) == nil {
+		return
+	}
+
+	defer lockUpload(bucketName, uploadID)()
+
+	if err := os.RemoveAll(uploadDir(bucketName, uploadID)); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка удаления загрузки")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func ListPartsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName, objectName, ok := parseObjectPath(r.URL.Path)
+	if !ok {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Неверный путь. Ожидалось /{bucketName}/{objectName}")
+		return
+	}
+
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+	if lookupUpload(w, r, bucketName, objectName, uploadID) == nil {
+		return
+	}
+
+	maxParts := maxListParts
+	if value := query.Get("max-parts"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Некорректное значение max-parts")
+			return
+		}
+		if parsed < maxParts {
+			maxParts = parsed
+		}
+	}
+
+	marker := 0
+	if value := query.Get("part-number-marker"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Некорректное значение part-number-marker")
+			return
+		}
+		marker = parsed
+	}
+
+	unlock := lockUpload(bucketName, uploadID)
+	parts, err := readUploadedParts(bucketName, uploadID)
+	unlock()
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения списка частей")
+		return
+	}
+
+	result := ListPartsResult{
+		Bucket:           bucketName,
+		Key:              objectName,
+		UploadID:         uploadID,
+		PartNumberMarker: marker,
+		MaxParts:         maxParts,
+		StorageClass:     "STANDARD",
+	}
+	for _, part := range parts {
+		if part.PartNumber <= marker {
+			continue
+		}
+		if len(result.Parts) == maxParts {
+			result.IsTruncated = true
+			break
+		}
+		result.Parts = append(result.Parts, PartInfo{
+			PartNumber:   part.PartNumber,
+			LastModified: formatS3Time(part.LastModified),
+			ETag:         part.ETag,
+			Size:         part.Size,
+		})
+		result.NextPartNumberMarker = part.PartNumber
+	}
+
+	writeXMLResult(w, http.StatusOK, result)
+}
+
+func ListMultipartUploadsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName := strings.Trim(r.URL.Path, "/")
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if !exists {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+
+	entries, err := os.ReadDir(multipartDir(bucketName))
+	if err != nil && !os.IsNotExist(err) {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения списка загрузок")
+		return
+	}
+
+	result := ListMultipartUploadsResult{Bucket: bucketName, Prefix: prefix}
+	for _, entry := range entries {
+		if !entry.IsDir() || !isValidUploadID(entry.Name()) {
+			continue
+		}
+		upload, err := readMultipartUpload(bucketName, entry.Name())
+		if err != nil || !strings.HasPrefix(upload.Key, prefix) {
+			continue
+		}
+		result.Uploads = append(result.Uploads, UploadInfo{
+			Key:          upload.Key,
+			UploadID:     upload.UploadID,
+			Initiated:    formatS3Time(upload.Initiated),
+			StorageClass: "STANDARD",
+		})
+	}
+	sort.Slice(result.Uploads, func(i, j int) bool {
+		if result.Uploads[i].Key != result.Uploads[j].Key {
+			return result.Uploads[i].Key < result.Uploads[j].Key
+		}
+		return result.Uploads[i].Initiated < result.Uploads[j].Initiated
+	})
+
+	writeXMLResult(w, http.StatusOK, result)
+}
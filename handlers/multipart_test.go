@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func mustCreateUpload(t *testing.T, bucketName, objectName string) string {
+	t.Helper()
+	w := serve(CreateMultipartUploadHandler, "POST", "/"+bucketName+"/"+objectName+"?uploads", "", nil)
+	var result InitiateMultipartUploadResult
+	if w.Code != http.StatusOK || xml.Unmarshal(w.Body.Bytes(), &result) != nil || result.UploadID == "" {
+		t.Fatalf("создание загрузки: %d %s", w.Code, w.Body)
+	}
+	return result.UploadID
+}
+
+func mustUploadPart(t *testing.T, bucketName, objectName, uploadID string, partNumber int, body string) string {
+	t.Helper()
+	target := fmt.Sprintf("/%s/%s?partNumber=%d&uploadId=%s", bucketName, objectName, partNumber, uploadID)
+	w := serve(UploadPartHandler, "PUT", target, body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("загрузка части %d: %d %s", partNumber, w.Code, w.Body)
+	}
+	return w.Header().Get("ETag")
+}
+
+func completeBody(etags ...string) string {
+	var body strings.Builder
+	body.WriteString("<CompleteMultipartUpload>")
+	for i, etag := range etags {
+		fmt.Fprintf(&body, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", i+1, etag)
+	}
+	body.WriteString("</CompleteMultipartUpload>")
+	return body.String()
+}
+
+func TestMultipartUpload(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "multipart-bucket")
+
+	first := strings.Repeat("a", minPartSize)
+	second := "tail"
+	uploadID := mustCreateUpload(t, "multipart-bucket", "big")
+	etag1 := mustUploadPart(t, "multipart-bucket", "big", uploadID, 1, first)
+	etag2 := mustUploadPart(t, "multipart-bucket", "big", uploadID, 2, second)
+
+	w := serve(ListPartsHandler, "GET", "/multipart-bucket/big?uploadId="+uploadID+"&max-parts=1", "", nil)
+	var parts ListPartsResult
+	if err := xml.Unmarshal(w.Body.Bytes(), &parts); err != nil || len(parts.Parts) != 1 || !parts.IsTruncated || parts.NextPartNumberMarker != 1 {
+		t.Fatalf("ListParts: %d %s", w.Code, w.Body)
+	}
+
+	w = serve(CompleteMultipartUploadHandler, "POST", "/multipart-bucket/big?uploadId="+uploadID, completeBody(etag1, etag2), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("завершение загрузки: %d %s", w.Code, w.Body)
+	}
+	sum1 := md5.Sum([]byte(first))
+	sum2 := md5.Sum([]byte(second))
+	total := md5.Sum(append(sum1[:], sum2[:]...))
+	wantETag := `"` + hex.EncodeToString(total[:]) + `-2"`
+	var result CompleteMultipartUploadResult
+	if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil || result.ETag != wantETag {
+		t.Fatalf("ETag %q, ожидалось %q", result.ETag, wantETag)
+	}
+
+	w = serve(GetObjectHandler, "GET", "/multipart-bucket/big", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != first+second || w.Header().Get("ETag") != wantETag {
+		t.Fatalf("GET собранного объекта: код %d, длина %d, ETag %s", w.Code, w.Body.Len(), w.Header().Get("ETag"))
+	}
+	if w := serve(ListPartsHandler, "GET", "/multipart-bucket/big?uploadId="+uploadID, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("загрузка осталась после завершения: %d", w.Code)
+	}
+}
+
+func TestCompleteMultipartUploadErrors(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "multipart-bucket")
+	uploadID := mustCreateUpload(t, "multipart-bucket", "key")
+	etag1 := mustUploadPart(t, "multipart-bucket", "key", uploadID, 1, "small")
+	etag2 := mustUploadPart(t, "multipart-bucket", "key", uploadID, 2, "tail")
+	etag3 := mustUploadPart(t, "multipart-bucket", "key", uploadID, 3, strings.Repeat("c", minPartSize))
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode string
+	}{
+		{"пустой список частей", "<CompleteMultipartUpload></CompleteMultipartUpload>", "MalformedXML"},
+		{"неверный ETag", completeBody(`"00000000000000000000000000000000"`), "InvalidPart"},
+		{"часть меньше 5 МБ не последняя", completeBody(etag1, etag2), "EntityTooSmall"},
+		{
+			"части не по возрастанию",
+			"<CompleteMultipartUpload><Part><PartNumber>3</PartNumber><ETag>" + etag3 + "</ETag></Part>" +
+				"<Part><PartNumber>1</PartNumber><ETag>" + etag1 + "</ETag></Part></CompleteMultipartUpload>",
+			"InvalidPartOrder",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(CompleteMultipartUploadHandler, "POST", "/multipart-bucket/key?uploadId="+uploadID, tt.body, nil)
+			var s3Err S3Error
+			if w.Code != http.StatusBadRequest || xml.Unmarshal(w.Body.Bytes(), &s3Err) != nil || s3Err.Code != tt.wantCode {
+				t.Errorf("код %d, тело %s; ожидалась ошибка %s", w.Code, w.Body, tt.wantCode)
+			}
+		})
+	}
+
+	if w := serve(AbortMultipartUploadHandler, "DELETE", "/multipart-bucket/key?uploadId="+uploadID, "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("отмена загрузки: %d %s", w.Code, w.Body)
+	}
+	w := serve(UploadPartHandler, "PUT", "/multipart-bucket/key?partNumber=4&uploadId="+uploadID, "x", nil)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "NoSuchUpload") {
+		t.Errorf("часть отменённой загрузки: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	userMetadataPrefix  = "x-amz-meta-"
+	maxUserMetadataSize = 2 << 10
+)
+
+// ObjectHeaders — заголовки, которые клиент задаёт при загрузке объекта и получает
+// обратно без изменений при GET и HEAD. UserMetadata хранит x-amz-meta-* без префикса.
+type ObjectHeaders struct {
+	ContentDisposition string
+	ContentEncoding    string
+	CacheControl       string
+	ContentLanguage    string
+	Expires            string
+	UserMetadata       map[string]string
+}
+
+// objectHeadersColumns — колонки ObjectHeaders в objects.csv и upload.csv.
+var objectHeadersColumns = []string{"ContentDisposition", "ContentEncoding", "CacheControl", "ContentLanguage", "Expires", "UserMetadata"}
+
+func headersToRecord(headers ObjectHeaders) []string {
+	return []string{
+		headers.ContentDisposition,
+		headers.ContentEncoding,
+		headers.CacheControl,
+		headers.ContentLanguage,
+		headers.Expires,
+		encodeUserMetadata(headers.UserMetadata),
+	}
+}
+
+// recordToHeaders ожидает ровно len(objectHeadersColumns) значений.
+func recordToHeaders(record []string) ObjectHeaders {
+	return ObjectHeaders{
+		ContentDisposition: record[0],
+		ContentEncoding:    record[1],
+		CacheControl:       record[2],
+		ContentLanguage:    record[3],
+		Expires:            record[4],
+		UserMetadata:       decodeUserMetadata(record[5]),
+	}
+}
+
+// encodeUserMetadata упаковывает пользовательские метаданные в одну колонку CSV
+// в виде query-строки: ключи отсортированы, значения экранированы.
+func encodeUserMetadata(metadata map[string]string) string {
+	values := make(url.Values, len(metadata))
+	for name, value := range metadata {
+		values.Set(name, value)
+	}
+	return values.Encode()
+}
+
+func decodeUserMetadata(encoded string) map[string]string {
+	if encoded == "" {
+		return nil
+	}
+	values, err := url.ParseQuery(encoded)
+	if err != nil {
+		return nil
+	}
+	metadata := make(map[string]string, len(values))
+	for name := range values {
+		metadata[name] = values.Get(name)
+	}
+	return metadata
+}
+
+// requestObjectHeaders собирает сохраняемые заголовки из запроса на загрузку.
+// При ошибке пишет ответ сам и возвращает false.
+func requestObjectHeaders(w http.ResponseWriter, r *http.Request) (ObjectHeaders, bool) {
+	headers := ObjectHeaders{
+		ContentDisposition: r.Header.Get("Content-Disposition"),
+		ContentEncoding:    storedContentEncoding(r.Header.Get("Content-Encoding")),
+		CacheControl:       r.Header.Get("Cache-Control"),
+		ContentLanguage:    r.Header.Get("Content-Language"),
+		Expires:            r.Header.Get("Expires"),
+	}
+
+	size := 0
+	for name, values := range r.Header {
+		name = strings.ToLower(name)
+		if !strings.HasPrefix(name, userMetadataPrefix) || len(name) == len(userMetadataPrefix) {
+			continue
+		}
+		if headers.UserMetadata == nil {
+			headers.UserMetadata = make(map[string]string)
+		}
+		key := strings.TrimPrefix(name, userMetadataPrefix)
+		value := strings.Join(values, ",")
+		headers.UserMetadata[key] = value
+		size += len(key) + len(value)
+	}
+	if size > maxUserMetadataSize {
+		WriteS3Error(w, r, http.StatusBadRequest, "MetadataTooLarge", "Пользовательские метаданные не должны превышать 2 КБ")
+		return headers, false
+	}
+	return headers, true
+}
+
+// storedContentEncoding убирает aws-chunked: это кодировка передачи тела при подписи
+// по фрагментам, к содержимому объекта она не относится.
+func storedContentEncoding(value string) string {
+	var encodings []string
+	for _, encoding := range strings.Split(value, ",") {
+		encoding = strings.TrimSpace(encoding)
+		if encoding != "" && encoding != "aws-chunked" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	return strings.Join(encodings, ",")
+}
+
+func setObjectHeaders(w http.ResponseWriter, headers ObjectHeaders) {
+	standard := []struct{ name, value string }{
+		{"Content-Disposition", headers.ContentDisposition},
+		{"Content-Encoding", headers.ContentEncoding},
+		{"Cache-Control", headers.CacheControl},
+		{"Content-Language", headers.ContentLanguage},
+		{"Expires", headers.Expires},
+	}
+	for _, header := range standard {
+		if header.value != "" {
+			w.Header().Set(header.name, header.value)
+		}
+	}
+	for name, value := range headers.UserMetadata {
+		// Имя задаётся напрямую, чтобы не менять регистр, как это сделал бы Header.Set.
+		w.Header()[userMetadataPrefix+name] = []string{value}
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestObjectHeadersRoundTrip(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "headers-bucket")
+
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain")
+	header.Set("Content-Disposition", `attachment; filename="report.txt"`)
+	header.Set("Content-Encoding", "aws-chunked,gzip")
+	header.Set("Cache-Control", "max-age=60")
+	header.Set("Content-Language", "ru")
+	header.Set("Expires", "Wed, 21 Oct 2015 07:28:00 GMT")
+	header.Set("X-Amz-Meta-Author", "Иван, Пётр")
+	header.Set("X-Amz-Meta-Note", "a=b&c")
+	mustPutObject(t, "headers-bucket", "report", "hello", header)
+
+	want := map[string]string{
+		"Content-Type":        "text/plain",
+		"Content-Disposition": `attachment; filename="report.txt"`,
+		"Content-Encoding":    "gzip",
+		"Cache-Control":       "max-age=60",
+		"Content-Language":    "ru",
+		"Expires":             "Wed, 21 Oct 2015 07:28:00 GMT",
+	}
+	// Пользовательские метаданные возвращаются в нижнем регистре, как их хранит S3.
+	wantMetadata := map[string]string{
+		"x-amz-meta-author": "Иван, Пётр",
+		"x-amz-meta-note":   "a=b&c",
+	}
+	for _, method := range []string{"GET", "HEAD"} {
+		handler := GetObjectHandler
+		if method == "HEAD" {
+			handler = HeadObjectHandler
+		}
+		w := serve(handler, method, "/headers-bucket/report", "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: код %d", method, w.Code)
+		}
+		for name, value := range want {
+			if got := w.Header().Get(name); got != value {
+				t.Errorf("%s: %s = %q, ожидалось %q", method, name, got, value)
+			}
+		}
+		for name, value := range wantMetadata {
+			if got := w.Header()[name]; len(got) != 1 || got[0] != value {
+				t.Errorf("%s: %s = %q, ожидалось %q", method, name, got, value)
+			}
+		}
+	}
+}
+
+func TestUserMetadataTooLarge(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "headers-bucket")
+
+	header := http.Header{"X-Amz-Meta-Big": {strings.Repeat("x", maxUserMetadataSize)}}
+	w := serve(UploadObjectHandler, "PUT", "/headers-bucket/big", "x", header)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "MetadataTooLarge") {
+		t.Fatalf("код %d, тело %s", w.Code, w.Body)
+	}
+	if w := serve(GetObjectHandler, "GET", "/headers-bucket/big", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("отклонённый объект сохранён: %d", w.Code)
+	}
+}
+
+func TestObjectHeadersRecord(t *testing.T) {
+	headers := ObjectHeaders{
+		ContentDisposition: "inline",
+		CacheControl:       "no-cache",
+		UserMetadata:       map[string]string{"a": "1,2", "b": "x=y&z"},
+	}
+	record := headersToRecord(headers)
+	if len(record) != len(objectHeadersColumns) {
+		t.Fatalf("%d колонок, ожидалось %d", len(record), len(objectHeadersColumns))
+	}
+	if got := recordToHeaders(record); !reflect.DeepEqual(got, headers) {
+		t.Errorf("получено %+v, ожидалось %+v", got, headers)
+	}
+	if got := recordToHeaders(headersToRecord(ObjectHeaders{})); !reflect.DeepEqual(got, ObjectHeaders{}) {
+		t.Errorf("пустые заголовки: %+v", got)
+	}
+}
+
+func TestStoredContentEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                  "",
+		"gzip":              "gzip",
+		"aws-chunked":       "",
+		"aws-chunked,gzip":  "gzip",
+		"gzip, aws-chunked": "gzip",
+		"gzip,br":           "gzip,br",
+	}
+	for input, want := range tests {
+		if got := storedContentEncoding(input); got != want {
+			t.Errorf("storedContentEncoding(%q) = %q, ожидалось %q", input, got, want)
+		}
+	}
+}
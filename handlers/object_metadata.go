@@ -3,179 +3,207 @@ package handlers
 import (
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"sync"
+	"strconv"
 )
 
-var objectMetadataLock sync.Mutex
+// bucketMetadataLocks защищают objects.csv каждого бакета: чтение идёт параллельно,
+// запись исключительна, а бакеты друг другу не мешают.
+var bucketMetadataLocks = newLockRegistry()
 
-func AddObjectToMetadata(bucketName, objectName, contentType string, size int64, lastModified string) error {
-	objectMetadataLock.Lock()
-	defer objectMetadataLock.Unlock()
+var objectsCSVHeader = append([]string{"ObjectName", "Size", "ContentType", "LastModified", "ETag", "VersionID", "DeleteMarker", "Encryption", "SealedKey", "CustomerKeyMD5"}, append(objectHeadersColumns, "Tags")...)
 
-	metadataFilePath := filepath.Join(BaseDir, bucketName, "objects.csv")
-
-	if _, err := os.Stat(metadataFilePath); os.IsNotExist(err) {
-		file, err := os.Create(metadataFilePath)
-		if err != nil {
-			return fmt.Errorf("не удалось создать файл objects.csv: %v", err)
-		}
-		defer file.Close()
-
-		writer := csv.NewWriter(file)
-		defer writer.Flush()
-
-		if err := writer.Write([]string{"ObjectName", "Size", "ContentType", "LastModified"}); err != nil {
-			return fmt.Errorf("не удалось записать заголовки в файл objects.csv: %v", err)
-		}
+// padRecord дополняет строки, записанные до появления новых колонок, пустыми значениями.
+func padRecord(record []string, length int) []string {
+	for len(record) < length {
+		record = append(record, "")
 	}
+	return record
+}
 
-	file, err := os.OpenFile(metadataFilePath, os.O_APPEND|os.O_WRONLY, 0o644)
-	if err != nil {
-		return fmt.Errorf("не удалось открыть файл objects.csv для записи: %v", err)
+func objectToRecord(object ObjectMetadata) []string {
+	deleteMarker := ""
+	if object.DeleteMarker {
+		deleteMarker = "true"
 	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	record := []string{object.Key, strconv.FormatInt(object.Size, 10), object.ContentType, object.LastModified, object.StoredETag, object.VersionID, deleteMarker, object.Encryption, object.SealedKey, object.CustomerKeyMD5}
+	record = append(record, headersToRecord(object.ObjectHeaders)...)
+	return append(record, encodeTags(object.Tags))
+}
 
-	record := []string{objectName, fmt.Sprintf("%d", size), contentType, lastModified}
-	if err := writer.Write(record); err != nil {
-		return fmt.Errorf("не удалось записать метаданные объекта: %v", err)
-	}
-	return nil
+func recordToObject(record []string) (ObjectMetadata, error) {
+	record = padRecord(record, len(objectsCSVHeader))
+	size, err := strconv.ParseInt(record[1], 10, 64)
+	if err != nil {
+		return ObjectMetadata{}, fmt.Errorf("некорректный размер объекта %s: %v", record[0], err)
+	}
+	return ObjectMetadata{
+		Key:          record[0],
+		Size:         size,
+		ContentType:  record[2],
+		LastModified: record[3],
+		StoredETag:   record[4],
+		VersionID:    record[5],
+		DeleteMarker: record[6] == "true",
+		ObjectEncryption: ObjectEncryption{
+			Encryption:     record[7],
+			SealedKey:      record[8],
+			CustomerKeyMD5: record[9],
+		},
+		ObjectHeaders: recordToHeaders(record[10 : 10+len(objectHeadersColumns)]),
+		Tags:          decodeTags(record[10+len(objectHeadersColumns)]),
+	}, nil
 }
 
-func isObjectInMetadata(bucketName, objectName string) (bool, error) {
-	metadataFilePath := filepath.Join(BaseDir, bucketName, "objects.csv")
+// readObjects читает версии объектов бакета. Строки идут в порядке записи, поэтому если
+// версия встречается в objects.csv несколько раз, актуальной считается последняя запись.
+func (s *CSVStore) readObjects(bucketName string) (*objectIndex, error) {
+	metadataFilePath := filepath.Join(s.baseDir, bucketName, "objects.csv")
 
 	file, err := os.Open(metadataFilePath)
 	if err != nil {
-		return false, fmt.Errorf("не удалось открыть файл метаданных объектов: %v", err)
+		return nil, fmt.Errorf("не удалось открыть файл метаданных объектов: %v", err)
 	}
 	defer file.Close()
 
 	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
 	records, err := reader.ReadAll()
 	if err != nil {
-		return false, fmt.Errorf("не удалось прочитать файл метаданных объектов: %v", err)
+		return nil, fmt.Errorf("не удалось прочитать файл метаданных объектов: %v", err)
 	}
 
-	for _, record := range records {
-		if len(record) > 0 && record[0] == objectName {
-			return true, nil
+	idx := newObjectIndex()
+	for i, record := range records {
+		if i == 0 || len(record) < 4 {
+			continue
 		}
+		object, err := recordToObject(record)
+		if err != nil {
+			return nil, err
+		}
+		idx.put(object)
 	}
-	return false, nil
+	return idx, nil
 }
 
-func UpdateObjectInMetadata(bucketName, objectName, contentType string, size int64, lastModified string) error {
-	objectMetadataLock.Lock()
-	defer objectMetadataLock.Unlock()
-
-	metadataFilePath := filepath.Join(BaseDir, bucketName, "objects.csv")
-	tempFilePath := metadataFilePath + ".tmp"
-
-	file, err := os.Open(metadataFilePath)
-	if err != nil {
-		return fmt.Errorf("не удалось открыть файл objects.csv: %v", err)
+func (s *CSVStore) writeObjects(bucketName string, idx *objectIndex) error {
+	metadataFilePath := filepath.Join(s.baseDir, bucketName, "objects.csv")
+	// Временный файл лежит в служебной директории, чтобы не занимать ключи объектов бакета.
+	tempDir := filepath.Join(s.baseDir, bucketName, systemDirName)
+	if err := os.MkdirAll(tempDir, 0o755); err != nil {
+		return fmt.Errorf("не удалось создать служебную директорию бакета: %v", err)
 	}
-	defer file.Close()
 
-	tempFile, err := os.Create(tempFilePath)
+	err := writeFileAtomic(metadataFilePath, tempDir, func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		writer.Write(objectsCSVHeader)
+		for _, object := range idx.records() {
+			writer.Write(objectToRecord(object))
+		}
+		writer.Flush()
+		return writer.Error()
+	})
 	if err != nil {
-		return fmt.Errorf("не удалось создать временный файл для objects.csv: %v", err)
+		return fmt.Errorf("не удалось записать objects.csv: %v", err)
 	}
-	defer tempFile.Close()
+	return nil
+}
 
-	reader := csv.NewReader(file)
-	writer := csv.NewWriter(tempFile)
-	defer writer.Flush()
+func (s *CSVStore) ListObjects(bucketName string) ([]ObjectMetadata, error) {
+	defer bucketMetadataLocks.rlock(bucketName)()
 
-	records, err := reader.ReadAll()
+	idx, err := s.readObjects(bucketName)
 	if err != nil {
-		return fmt.Errorf("не удалось прочитать файл objects.csv: %v", err)
+		return nil, err
 	}
+	return idx.objects(), nil
+}
 
-	updated := false
-	for _, record := range records {
-		if len(record) > 0 && record[0] == objectName {
-			record[1] = fmt.Sprintf("%d", size)
-			record[2] = contentType
-			record[3] = lastModified
-			updated = true
-		}
-		if err := writer.Write(record); err != nil {
-			return fmt.Errorf("не удалось записать запись в временный файл: %v", err)
-		}
-	}
+func (s *CSVStore) ListObjectVersions(bucketName string) ([]ObjectMetadata, error) {
+	defer bucketMetadataLocks.rlock(bucketName)()
 
-	if !updated {
-		newRecord := []string{objectName, fmt.Sprintf("%d", size), contentType, lastModified}
-		if err := writer.Write(newRecord); err != nil {
-			return fmt.Errorf("не удалось записать новую запись в временный файл: %v", err)
-		}
+	idx, err := s.readObjects(bucketName)
+	if err != nil {
+		return nil, err
 	}
+	return idx.allVersions(), nil
+}
+
+func (s *CSVStore) GetObject(bucketName, objectName string) (*ObjectMetadata, error) {
+	defer bucketMetadataLocks.rlock(bucketName)()
 
-	if err := os.Rename(tempFilePath, metadataFilePath); err != nil {
-		return fmt.Errorf("не удалось заменить файл objects.csv: %v", err)
+	idx, err := s.readObjects(bucketName)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return idx.current(objectName), nil
 }
 
-func DeleteObjectFromMetadata(bucketName, objectName string) error {
-	objectMetadataLock.Lock()
-	defer objectMetadataLock.Unlock()
-
-	metadataFilePath := filepath.Join(BaseDir, bucketName, "objects.csv")
-	tempFilePath := metadataFilePath + ".tmp"
+func (s *CSVStore) GetObjectVersion(bucketName, objectName, versionID string) (*ObjectMetadata, error) {
+	defer bucketMetadataLocks.rlock(bucketName)()
 
-	file, err := os.Open(metadataFilePath)
+	idx, err := s.readObjects(bucketName)
 	if err != nil {
-		return fmt.Errorf("не удалось открыть файл objects.csv: %v", err)
+		return nil, err
 	}
-	defer file.Close()
+	return idx.version(objectName, versionID), nil
+}
+
+func (s *CSVStore) GetObjectVersions(bucketName, objectName string) ([]ObjectMetadata, error) {
+	defer bucketMetadataLocks.rlock(bucketName)()
 
-	tempFile, err := os.Create(tempFilePath)
+	idx, err := s.readObjects(bucketName)
 	if err != nil {
-		return fmt.Errorf("не удалось создать временный файл для objects.csv: %v", err)
+		return nil, err
 	}
-	defer tempFile.Close()
+	return idx.keyVersions(objectName), nil
+}
 
-	reader := csv.NewReader(file)
-	writer := csv.NewWriter(tempFile)
-	defer writer.Flush()
+func (s *CSVStore) PutObject(bucketName string, object ObjectMetadata) error {
+	defer bucketMetadataLocks.lock(bucketName)()
 
-	records, err := reader.ReadAll()
+	idx, err := s.readObjects(bucketName)
 	if err != nil {
-		return fmt.Errorf("не удалось прочитать файл objects.csv: %v", err)
+		return err
 	}
+	idx.put(object)
+	return s.writeObjects(bucketName, idx)
+}
 
-	for _, record := range records {
-		if len(record) > 0 && record[0] != objectName {
-			if err := writer.Write(record); err != nil {
-				return fmt.Errorf("не удалось записать запись в временный файл: %v", err)
-			}
-		}
-	}
+func (s *CSVStore) UpdateObject(bucketName string, object ObjectMetadata) error {
+	defer bucketMetadataLocks.lock(bucketName)()
 
-	if err := os.Rename(tempFilePath, metadataFilePath); err != nil {
-		return fmt.Errorf("не удалось заменить файл objects.csv: %v", err)
+	idx, err := s.readObjects(bucketName)
+	if err != nil {
+		return err
 	}
-	return nil
+	if !idx.update(object) {
+		return fmt.Errorf("версия %s объекта %s не найдена", formatVersionID(object.VersionID), object.Key)
+	}
+	return s.writeObjects(bucketName, idx)
 }
 
-func isBucketEmpty(bucketDir string) (bool, error) {
-	entries, err := os.ReadDir(bucketDir)
+func (s *CSVStore) DeleteObject(bucketName, objectName, versionID string) error {
+	defer bucketMetadataLocks.lock(bucketName)()
+
+	idx, err := s.readObjects(bucketName)
 	if err != nil {
-		return false, err
+		return err
 	}
+	idx.remove(objectName, versionID)
+	return s.writeObjects(bucketName, idx)
+}
 
-	for _, entry := range entries {
-		if entry.Name() != "objects.csv" {
-			return false, nil
-		}
+func (s *CSVStore) ApplyObjectChanges(bucketName string, changes []ObjectChange) error {
+	defer bucketMetadataLocks.lock(bucketName)()
+
+	idx, err := s.readObjects(bucketName)
+	if err != nil {
+		return err
 	}
-	return true, nil
+	idx.apply(changes)
+	return s.writeObjects(bucketName, idx)
 }
@@ -1,71 +1,118 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 )
 
+type PutObjectResult struct {
+	XMLName xml.Name `xml:"PutObjectResult"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+// parseContentMD5 разбирает заголовок Content-MD5. Пустой заголовок допустим и даёт nil.
+func parseContentMD5(value string) ([]byte, bool) {
+	if value == "" {
+		return nil, true
+	}
+	sum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(sum) != md5.Size {
+		return nil, false
+	}
+	return sum, true
+}
+
+var errBadDigest = errors.New("Content-MD5 не совпадает с содержимым")
+
+// digestReader считает MD5 прочитанных данных и, если задан ожидаемый хеш,
+// возвращает errBadDigest вместо io.EOF при несовпадении.
+type digestReader struct {
+	reader   io.Reader
+	hash     hash.Hash
+	expected []byte
+	size     int64
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.reader.Read(p)
+	d.hash.Write(p[:n])
+	d.size += int64(n)
+	if err == io.EOF && d.expected != nil && !bytes.Equal(d.hash.Sum(nil), d.expected) {
+		return n, errBadDigest
+	}
+	return n, err
+}
+
 func UploadObjectHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "PUT" {
-		WriteXMLResponse(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
 		return
 	}
 
 	pathSegments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
 	if len(pathSegments) < 2 {
-		WriteXMLResponse(w, http.StatusInternalServerError, "UndefindedRoute", "Неверный путь ")
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Неверный путь ")
 		return
 	}
 
-	if r.ContentLength == 0 {
-		WriteXMLResponse(w, http.StatusBadRequest, "EmptyObject", "Объект не может быть пустым")
+	if !validatePresignedRequest(w, r) {
 		return
 	}
 
 	bucketName := pathSegments[0]
-	originalName := strings.Join(pathSegments[1:], "/")
-	ext := filepath.Ext(originalName)
-	base := strings.TrimSuffix(originalName, ext)
-	objectNameTimestamp := time.Now().Format("20060102_150405")
-	objectName := fmt.Sprintf("%s_%s%s", base, objectNameTimestamp, ext)
+	objectName := strings.Join(pathSegments[1:], "/")
 
 	if strings.Contains(bucketName, ".") {
-		WriteXMLResponse(w, http.StatusUnsupportedMediaType, "BucketKeyShouldntHasType", "Bucket не должен содержать рассширения")
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidBucketName", "Bucket не должен содержать рассширения")
+		return
+	}
+
+	if isReservedObjectName(objectName) {
+		WriteS3Error(w, r, http.StatusForbidden, "AccessDenied", "Перезапись служебных файлов бакета запрещена")
 		return
 	}
-	// if strings.Contains(objectName, ".") {
-	// 	WriteXMLResponse(w, http.StatusUnsupportedMediaType, "ObjectKeyShouldntHasType", "ObjectKey не должен содержать рассширения")
-	// 	return
-	// }
 
-	bucketDir := filepath.Join(BaseDir, bucketName)
-	if _, err := os.Stat(bucketDir); os.IsNotExist(err) {
-		WriteXMLResponse(w, http.StatusNotFound, "BucketIsNotExist", "Бакет не найден")
+	bucket, err := Store.GetBucket(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if bucket == nil {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
 		return
 	}
 
-	objectPath := filepath.Join(bucketDir, objectName)
+	expectedMD5, ok := parseContentMD5(r.Header.Get("Content-MD5"))
+	if !ok {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidDigest", "Некорректный заголовок Content-MD5")
+		return
+	}
 
-	if err := os.MkdirAll(filepath.Dir(objectPath), 0o755); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "ErrorDir", "Ошибка создания директорий для объекта")
+	encryption, ok := requestEncryption(w, r)
+	if !ok {
 		return
 	}
 
-	file, err := os.Create(objectPath)
-	if err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "CouldntCreate", "Ошибка создания объекта")
+	headers, ok := requestObjectHeaders(w, r)
+	if !ok {
 		return
 	}
-	defer file.Close()
 
-	written, err := io.Copy(file, r.Body)
-	if err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "CouldntWrite", "Ошибка записи данных в объект")
+	tags, ok := requestTagging(w, r)
+	if !ok {
 		return
 	}
 
@@ -74,127 +121,356 @@ func UploadObjectHandler(w http.ResponseWriter, r *http.Request) {
 		contentType = "application/octet-stream"
 	}
 
-	timestamp := time.Now().UTC().Format(time.RFC3339)
-	if err := AddObjectToMetadata(bucketName, objectName, contentType, written, timestamp); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "InternalServerError", "Ошибка обновления метаданных объекта")
+	object, err := saveObject(bucket, ObjectMetadata{Key: objectName, ContentType: contentType, ObjectHeaders: headers, Tags: tags}, r.Body, encryption, expectedMD5)
+	if err != nil {
+		if writePayloadError(w, r, err) {
+			return
+		}
+		if errors.Is(err, errBadDigest) {
+			WriteS3Error(w, r, http.StatusBadRequest, "BadDigest", "Content-MD5 не совпадает с содержимым объекта")
+			return
+		}
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка сохранения объекта")
 		return
 	}
 
 	if err := UpdateBucketStatus(bucketName); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "InternalServerError", "Ошибка обновления статуса бакета")
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка обновления статуса бакета")
 		return
 	}
 
-	WriteXMLResponse(w, 201, "Success", "Успешно создан")
-	fmt.Fprintf(w, "Объект '%s' успешно создан в бакете '%s'", objectName, bucketName)
+	if bucket.Versioning != "" {
+		w.Header().Set("x-amz-version-id", formatVersionID(object.VersionID))
+	}
+	setEncryptionHeaders(w, object.ObjectEncryption)
+	w.Header().Set("ETag", object.ETag())
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(PutObjectResult{Bucket: bucketName, Key: objectName, ETag: object.ETag()})
+}
+
+// saveObject записывает содержимое новой версии объекта и добавляет её в метаданные.
+// Ключ, тип содержимого и прочие заголовки берутся из object, остальные поля заполняются здесь.
+func saveObject(bucket *BucketMetadata, object ObjectMetadata, data io.Reader, encryption *encryptionRequest, expectedMD5 []byte) (ObjectMetadata, error) {
+	versionID, err := nextVersionID(bucket)
+	if err != nil {
+		return object, fmt.Errorf("не удалось создать идентификатор версии: %w", err)
+	}
+
+	body := &digestReader{reader: data, hash: md5.New(), expected: expectedMD5}
+	encrypted, objectEncryption, err := encryption.encrypt(body)
+	if err != nil {
+		return object, fmt.Errorf("ошибка подготовки шифрования объекта: %w", err)
+	}
+	staged, err := ObjectBackend.Stage(bucket.Name, versionDataName(object.Key, versionID), encrypted)
+	if err != nil {
+		return object, err
+	}
+
+	// Close должен выполниться до того, как отпущен замок: пока журнал загрузки на диске,
+	// запись метаданных ключа не должна меняться.
+	defer lockObject(bucket.Name, object.Key)()
+	defer staged.Close()
+
+	object.Size = body.size
+	object.LastModified = time.Now().UTC().Format(time.RFC3339)
+	object.StoredETag = fmt.Sprintf("%x", body.hash.Sum(nil))
+	object.VersionID = versionID
+	object.ObjectEncryption = objectEncryption
+	if err := staged.Commit(object); err != nil {
+		return object, err
+	}
+	if err := Store.PutObject(bucket.Name, object); err != nil {
+		// Метаданные остались прежними, поэтому возвращаем и прежнее содержимое.
+		staged.Rollback()
+		return object, err
+	}
+	return object, nil
 }
 
 func DeleteObjectHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "DELETE" {
-		WriteXMLResponse(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
 		return
 	}
 
 	pathSegments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
 	if len(pathSegments) < 2 {
-		WriteXMLResponse(w, http.StatusBadRequest, "RouteNotFound", "Неверный путь. Ожидалось /{bucketName}/{objectName}")
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Неверный путь. Ожидалось /{bucketName}/{objectName}")
 		return
 	}
 
 	bucketName := pathSegments[0]
 	objectName := strings.Join(pathSegments[1:], "/")
 
-	if objectName == "objects.csv" {
-		WriteXMLResponse(w, http.StatusForbidden, "Forbidden", "Удаление файла objects.csv запрещено")
+	if isReservedObjectName(objectName) {
+		WriteS3Error(w, r, http.StatusForbidden, "AccessDenied", "Удаление служебных файлов бакета запрещено")
 		return
 	}
 
-	exists, err := isObjectInMetadata(bucketName, objectName)
+	bucket, err := Store.GetBucket(bucketName)
 	if err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "CouldntReadMetadata", "Ошибка чтения файла метаданных объектов")
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
 		return
 	}
-	if !exists {
-		WriteXMLResponse(w, http.StatusNotFound, "ObjectNotFound", "Объект не найден в метаданных")
+	if bucket == nil {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	defer lockObject(bucketName, objectName)()
+
+	if versionID, ok := versionIDParam(r); ok {
+		deleteObjectVersion(w, r, bucketName, objectName, versionID)
+		return
+	}
+
+	if bucket.Versioning != "" {
+		addDeleteMarker(w, r, bucket, objectName)
+		return
+	}
+
+	metadata, err := Store.GetObject(bucketName, objectName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных объектов")
+		return
+	}
+	if metadata == nil {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchKey", "Объект не найден в метаданных")
+		return
+	}
+
+	if err := removeObjectVersion(bucketName, *metadata); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка удаления объекта")
+		return
+	}
+
+	if err := UpdateBucketStatus(bucketName); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка обновления статуса бакета")
 		return
 	}
 
-	objectPath := filepath.Join(BaseDir, bucketName, objectName)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	if _, err := os.Stat(objectPath); os.IsNotExist(err) {
-		WriteXMLResponse(w, http.StatusNotFound, "ObjectNotFound", "Объект не найден")
+// addDeleteMarker скрывает объект в версионируемом бакете.
+func addDeleteMarker(w http.ResponseWriter, r *http.Request, bucket *BucketMetadata, objectName string) {
+	versionID, err := putDeleteMarker(bucket, objectName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка добавления маркера удаления")
 		return
 	}
 
-	if err := os.Remove(objectPath); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "CouldntDelete", "Ошибка удаления объекта")
+	if err := UpdateBucketStatus(bucket.Name); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка обновления статуса бакета")
 		return
 	}
 
-	if err := DeleteObjectFromMetadata(bucketName, objectName); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "CouldntDeleteMetadata", "Ошибка удаления записи из файла метаданных")
+	w.Header().Set("x-amz-delete-marker", "true")
+	w.Header().Set("x-amz-version-id", formatVersionID(versionID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteObjectVersion безвозвратно удаляет одну версию объекта или маркер удаления.
+func deleteObjectVersion(w http.ResponseWriter, r *http.Request, bucketName, objectName, versionID string) {
+	version, err := Store.GetObjectVersion(bucketName, objectName, versionID)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных объектов")
+		return
+	}
+	if version == nil {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchVersion", "Версия объекта не найдена")
+		return
+	}
+
+	if err := removeObjectVersion(bucketName, *version); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка удаления версии объекта")
 		return
 	}
 
 	if err := UpdateBucketStatus(bucketName); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "InternalServerError", "Ошибка обновления статуса бакета")
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка обновления статуса бакета")
 		return
 	}
 
-	WriteXMLResponse(w, http.StatusNoContent, "Deleted", "Объект успешно удалён")
+	if version.DeleteMarker {
+		w.Header().Set("x-amz-delete-marker", "true")
+	}
+	w.Header().Set("x-amz-version-id", formatVersionID(versionID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// putDeleteMarker добавляет маркер удаления и возвращает его версию.
+// Вызывается под замком ключа.
+func putDeleteMarker(bucket *BucketMetadata, objectName string) (string, error) {
+	var nullVersion *ObjectMetadata
+	if bucket.Versioning != versioningEnabled {
+		version, err := Store.GetObjectVersion(bucket.Name, objectName, "")
+		if err != nil {
+			return "", err
+		}
+		nullVersion = version
+	}
+
+	marker, err := newDeleteMarker(bucket, objectName)
+	if err != nil {
+		return "", err
+	}
+	if err := Store.PutObject(bucket.Name, marker); err != nil {
+		return "", err
+	}
+	if replaced := replacedNullVersion(marker, nullVersion); replaced != nil {
+		discardVersionData(bucket.Name, *replaced)
+	}
+	return marker.VersionID, nil
 }
 
-func getFileSize(path string) int64 {
-	info, err := os.Stat(path)
+// newDeleteMarker готовит маркер удаления. При приостановленном версионировании маркер
+// получает null-версию и заменяет прежнюю null-версию, см. replacedNullVersion.
+func newDeleteMarker(bucket *BucketMetadata, objectName string) (ObjectMetadata, error) {
+	versionID, err := nextVersionID(bucket)
 	if err != nil {
-		return 0
+		return ObjectMetadata{}, fmt.Errorf("не удалось создать идентификатор версии: %v", err)
 	}
-	return info.Size()
+	return ObjectMetadata{Key: objectName, LastModified: time.Now().UTC().Format(time.RFC3339), VersionID: versionID, DeleteMarker: true}, nil
+}
+
+// replacedNullVersion возвращает null-версию, которую вытесняет маркер удаления.
+// Её содержимое удаляется после записи маркера в метаданные.
+func replacedNullVersion(marker ObjectMetadata, nullVersion *ObjectMetadata) *ObjectMetadata {
+	if marker.VersionID != "" || nullVersion == nil || nullVersion.DeleteMarker {
+		return nil
+	}
+	return nullVersion
+}
+
+// removeObjectVersion удаляет запись версии из метаданных, а затем её данные.
+func removeObjectVersion(bucketName string, version ObjectMetadata) error {
+	if err := Store.DeleteObject(bucketName, version.Key, version.VersionID); err != nil {
+		return err
+	}
+	discardVersionData(bucketName, version)
+	return nil
+}
+
+// discardVersionData удаляет содержимое версий, записи которых уже убраны из метаданных.
+// Сбой только пишется в журнал: клиентам версия больше не видна, а файл найдёт fsck.
+func discardVersionData(bucketName string, versions ...ObjectMetadata) {
+	for _, version := range versions {
+		if err := removeVersionData(bucketName, version); err != nil {
+			log.Printf("Не удалось удалить содержимое %s/%s (версия %s): %v", bucketName, version.Key, formatVersionID(version.VersionID), err)
+		}
+	}
+}
+
+// removeVersionData удаляет содержимое версии; у маркера удаления его нет.
+func removeVersionData(bucketName string, version ObjectMetadata) error {
+	if version.DeleteMarker {
+		return nil
+	}
+	err := ObjectBackend.Delete(bucketName, versionDataName(version.Key, version.VersionID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
 func GetObjectHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
-		WriteXMLResponse(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
 		return
 	}
 
 	pathSegments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
 	if len(pathSegments) < 2 {
-		WriteXMLResponse(w, http.StatusBadRequest, "RouteError", "Неверный путь. Ожидалось /{bucketName}/{objectName}")
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Неверный путь. Ожидалось /{bucketName}/{objectName}")
+		return
+	}
+
+	if !validatePresignedRequest(w, r) {
 		return
 	}
 
 	bucketName := pathSegments[0]
 	objectName := strings.Join(pathSegments[1:], "/")
 
-	bucketDir := filepath.Join(BaseDir, bucketName)
-	if _, err := os.Stat(bucketDir); os.IsNotExist(err) {
-		WriteXMLResponse(w, http.StatusNotFound, "BucketNotFound", "Бакет не найден")
+	if isReservedObjectName(objectName) {
+		WriteS3Error(w, r, http.StatusForbidden, "AccessDenied", "Доступ к служебным файлам бакета запрещён")
 		return
 	}
 
-	objectPath := filepath.Join(bucketDir, objectName)
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if !exists {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	unlock := rlockObject(bucketName, objectName)
+	defer unlock()
 
-	file, err := os.Open(objectPath)
+	metadata, err := getRequestedObject(r, bucketName, objectName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных объектов")
+		return
+	}
+	if metadata == nil {
+		if _, ok := versionIDParam(r); ok {
+			WriteS3Error(w, r, http.StatusNotFound, "NoSuchVersion", "Версия объекта не найдена")
+			return
+		}
+		setLatestDeleteMarkerHeaders(w, bucketName, objectName)
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchKey", "Объект не найден")
+		return
+	}
+	if metadata.DeleteMarker {
+		w.Header().Set("x-amz-delete-marker", "true")
+		w.Header().Set("x-amz-version-id", formatVersionID(metadata.VersionID))
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Версия является маркером удаления")
+		return
+	}
+
+	dataKey, ok := objectDataKey(w, r, metadata)
+	if !ok {
+		return
+	}
+
+	var file io.ReadSeekCloser
+	file, err = ObjectBackend.Get(bucketName, versionDataName(objectName, metadata.VersionID))
 	if os.IsNotExist(err) {
-		WriteXMLResponse(w, http.StatusNotFound, "NotFound", "Бакет не найден")
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchKey", "Объект не найден")
 		return
 	} else if err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "CouldntOpen", "Ошибка открытия")
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка открытия")
 		return
 	}
+	// Открытое содержимое остаётся читаемым, даже если объект сразу перезапишут или удалят.
+	unlock()
+	if dataKey != nil {
+		if file, err = newDecryptReader(file, dataKey, metadata.Size); err != nil {
+			WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка расшифровки объекта")
+			return
+		}
+	}
 	defer file.Close()
 
-	buffer := make([]byte, 512)
-	n, _ := file.Read(buffer)
-	contentType := http.DetectContentType(buffer[:n])
-	file.Seek(0, 0)
-
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", getFileSize(objectPath)))
-
-	if _, err := io.Copy(w, file); err != nil {
-		WriteXMLResponse(w, http.StatusInternalServerError, "CouldntShare", "Ошибка передачи объекта")
-		return
+	// Без Content-Type ServeContent сам определит тип по содержимому.
+	if metadata.ContentType != "" {
+		w.Header().Set("Content-Type", metadata.ContentType)
+	}
+	w.Header().Set("ETag", metadata.ETag())
+	w.Header().Set("Accept-Ranges", "bytes")
+	if metadata.VersionID != "" {
+		w.Header().Set("x-amz-version-id", metadata.VersionID)
 	}
+	setEncryptionHeaders(w, metadata.ObjectEncryption)
+	setObjectHeaders(w, metadata.ObjectHeaders)
+	setTaggingCountHeader(w, metadata.Tags)
+
+	// ServeContent обрабатывает Range (в том числе несколько диапазонов) и условные заголовки
+	// If-Match, If-None-Match, If-Modified-Since, If-Unmodified-Since по ETag и LastModified.
+	http.ServeContent(w, r, "", metadata.LastModifiedTime(), file)
 }
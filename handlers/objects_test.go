@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUploadEmptyObject(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "empty-bucket")
+
+	sse := http.Header{}
+	sse.Set("x-amz-server-side-encryption", sseS3)
+	tests := []struct {
+		name   string
+		key    string
+		header http.Header
+	}{
+		{"маркер папки", "dir/", nil},
+		{"пустой файл", "empty.txt", nil},
+		{"пустой файл с SSE-S3", "empty-sse.txt", sse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := mustPutObject(t, "empty-bucket", tt.key, "", tt.header)
+			if etag := w.Header().Get("ETag"); etag != `"d41d8cd98f00b204e9800998ecf8427e"` {
+				t.Errorf("ETag пустого объекта %s", etag)
+			}
+			w = serve(GetObjectHandler, "GET", "/empty-bucket/"+tt.key, "", nil)
+			if w.Code != http.StatusOK || w.Body.Len() != 0 {
+				t.Errorf("GET: код %d, длина %d", w.Code, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestGetObjectRange(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "range-bucket")
+	etag := mustPutObject(t, "range-bucket", "digits", "0123456789", nil).Header().Get("ETag")
+
+	tests := []struct {
+		name      string
+		header    http.Header
+		wantCode  int
+		wantBody  string
+		wantRange string
+	}{
+		{"весь объект", nil, http.StatusOK, "0123456789", ""},
+		{"диапазон", http.Header{"Range": {"bytes=2-4"}}, http.StatusPartialContent, "234", "bytes 2-4/10"},
+		{"с позиции до конца", http.Header{"Range": {"bytes=7-"}}, http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"суффикс", http.Header{"Range": {"bytes=-3"}}, http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"конец за пределами объекта", http.Header{"Range": {"bytes=8-100"}}, http.StatusPartialContent, "89", "bytes 8-9/10"},
+		{"начало за пределами объекта", http.Header{"Range": {"bytes=10-"}}, http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"If-Range совпал", http.Header{"Range": {"bytes=0-0"}, "If-Range": {etag}}, http.StatusPartialContent, "0", "bytes 0-0/10"},
+		{"If-Range не совпал", http.Header{"Range": {"bytes=0-0"}, "If-Range": {`"other"`}}, http.StatusOK, "0123456789", ""},
+		{"If-None-Match с Range", http.Header{"Range": {"bytes=0-0"}, "If-None-Match": {etag}}, http.StatusNotModified, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(GetObjectHandler, "GET", "/range-bucket/digits", "", tt.header)
+			if w.Code != tt.wantCode || w.Header().Get("Content-Range") != tt.wantRange {
+				t.Fatalf("код %d, Content-Range %q", w.Code, w.Header().Get("Content-Range"))
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("тело %q, ожидалось %q", w.Body, tt.wantBody)
+			}
+			if w.Header().Get("Accept-Ranges") != "bytes" && w.Code != http.StatusNotModified {
+				t.Errorf("нет Accept-Ranges: bytes")
+			}
+		})
+	}
+
+	w := serve(GetObjectHandler, "GET", "/range-bucket/digits", "", http.Header{"Range": {"bytes=0-1,8-9"}})
+	if w.Code != http.StatusPartialContent || !strings.HasPrefix(w.Header().Get("Content-Type"), "multipart/byteranges") {
+		t.Errorf("несколько диапазонов: код %d, Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestObjectETag(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "etag-bucket")
+
+	sum := md5.Sum([]byte("hello"))
+	goodMD5 := base64.StdEncoding.EncodeToString(sum[:])
+	wantETag := `"` + hex.EncodeToString(sum[:]) + `"`
+	otherSum := md5.Sum([]byte("other"))
+	badMD5 := base64.StdEncoding.EncodeToString(otherSum[:])
+
+	tests := []struct {
+		name     string
+		md5      string
+		wantCode int
+		wantErr  string
+	}{
+		{"без Content-MD5", "", http.StatusOK, ""},
+		{"верный Content-MD5", goodMD5, http.StatusOK, ""},
+		{"Content-MD5 другого содержимого", badMD5, http.StatusBadRequest, "BadDigest"},
+		{"Content-MD5 не в base64", "не base64", http.StatusBadRequest, "InvalidDigest"},
+		{"Content-MD5 неверной длины", base64.StdEncoding.EncodeToString([]byte("short")), http.StatusBadRequest, "InvalidDigest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.md5 != "" {
+				header.Set("Content-MD5", tt.md5)
+			}
+			w := serve(UploadObjectHandler, "PUT", "/etag-bucket/key", "hello", header)
+			if w.Code != tt.wantCode || (tt.wantErr != "" && !strings.Contains(w.Body.String(), "<Code>"+tt.wantErr+"</Code>")) {
+				t.Fatalf("код %d, тело %s", w.Code, w.Body)
+			}
+			if tt.wantCode == http.StatusOK && w.Header().Get("ETag") != wantETag {
+				t.Errorf("ETag %s, ожидалось %s", w.Header().Get("ETag"), wantETag)
+			}
+		})
+	}
+
+	mustPutObject(t, "etag-bucket", "kept", "hello", nil)
+	w := serve(UploadObjectHandler, "PUT", "/etag-bucket/kept", "changed", http.Header{"Content-Md5": {badMD5}})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("перезапись с неверным Content-MD5: %d", w.Code)
+	}
+	w = serve(GetObjectHandler, "GET", "/etag-bucket/kept", "", nil)
+	if w.Body.String() != "hello" || w.Header().Get("ETag") != wantETag {
+		t.Errorf("после отклонённой перезаписи: тело %q, ETag %s", w.Body, w.Header().Get("ETag"))
+	}
+	if w := serve(HeadObjectHandler, "HEAD", "/etag-bucket/kept", "", nil); w.Header().Get("ETag") != wantETag {
+		t.Errorf("HEAD: ETag %s", w.Header().Get("ETag"))
+	}
+}
+
+func TestLegacyObjectETag(t *testing.T) {
+	object := ObjectMetadata{Size: 255, LastModified: "2024-01-02T03:04:05Z"}
+	if got, want := object.ETag(), `"65937d25-ff"`; got != want {
+		t.Errorf("ETag без сохранённого значения %s, ожидалось %s", got, want)
+	}
+	object.StoredETag = "5d41402abc4b2a76b9719d911017c592"
+	if got := object.ETag(); got != `"5d41402abc4b2a76b9719d911017c592"` {
+		t.Errorf("сохранённый ETag %s", got)
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidatePresignedRequestWithoutCredentials(t *testing.T) {
+	setupTestStore(t)
+	credentialStore = map[string]string{exampleAccessKey: exampleSecretKey}
+	presigned, err := PresignURL("http://localhost:8080", "GET", "my-bucket", "key", "", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignURL: %v", err)
+	}
+	credentialStore = nil
+
+	w := httptest.NewRecorder()
+	if validatePresignedRequest(w, httptest.NewRequest("GET", presigned, nil)) {
+		t.Fatal("подписанная ссылка принята без ключей доступа")
+	}
+	if w.Code != http.StatusForbidden {
+		t.Errorf("код ответа %d, ожидался 403", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	if !validatePresignedRequest(w, httptest.NewRequest("GET", "http://localhost:8080/my-bucket/key", nil)) {
+		t.Errorf("обычный запрос отклонён: %s", w.Body)
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// RecoverDataDir убирает следы операций, прерванных сбоем: временные файлы перезаписи
+// метаданных, загрузки, не дошедшие до Commit, и директории бакетов, создание или удаление
+// которых не успело попасть в метаданные. Вызывается при старте, когда Store уже открыт,
+// а запросы ещё не принимаются.
+func RecoverDataDir(baseDir string) error {
+	buckets, err := Store.ListBuckets()
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(buckets))
+	for _, bucket := range buckets {
+		known[bucket.Name] = true
+	}
+
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать директорию данных: %v", err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(baseDir, entry.Name())
+		if !entry.IsDir() {
+			// В корне лежат только файлы метаданных, поэтому любой *.tmp здесь — недописанная перезапись.
+			if strings.HasSuffix(entry.Name(), tempFileSuffix) {
+				removeLeftover(path)
+			}
+			continue
+		}
+
+		if err := recoverCommits(baseDir, entry.Name()); err != nil {
+			return err
+		}
+		if err := recoverSystemDir(filepath.Join(path, systemDirName)); err != nil {
+			return err
+		}
+		if !known[entry.Name()] {
+			recoverOrphanBucket(path)
+		}
+	}
+	return nil
+}
+
+// recoverCommits доводит загрузки, прерванные между Commit и Close. Если в метаданных уже
+// лежит запись из журнала, загрузка завершилась и копия прежнего содержимого не нужна.
+// Иначе метаданные описывают прежнее содержимое: оно возвращается на место, а объект,
+// которого до загрузки не было, удаляется.
+func recoverCommits(baseDir, bucketName string) error {
+	stagingDir := filepath.Join(baseDir, bucketName, systemDirName, "staging")
+	journals, err := filepath.Glob(filepath.Join(stagingDir, "*"+journalFileSuffix))
+	if err != nil {
+		return err
+	}
+
+	for _, journalPath := range journals {
+		// Журнал пишется атомарно, поэтому нечитаемый журнал — повод остановиться, а не гадать.
+		journal, err := readCommitJournal(journalPath)
+		if err != nil {
+			return fmt.Errorf("не удалось прочитать журнал загрузки %s: %v", journalPath, err)
+		}
+		current, err := Store.GetObjectVersion(bucketName, journal.Object.Key, journal.Object.VersionID)
+		if err != nil {
+			return err
+		}
+		if current != nil && slices.Equal(objectToRecord(*current), objectToRecord(journal.Object)) {
+			continue
+		}
+
+		objectPath := filepath.Join(baseDir, bucketName, filepath.FromSlash(journal.ObjectName))
+		if journal.HasBackup {
+			backupPath := strings.TrimSuffix(journalPath, journalFileSuffix) + backupFileSuffix
+			if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+				// Копию уже вернул Rollback или предыдущий запуск восстановления.
+				continue
+			}
+			if err := os.Rename(backupPath, objectPath); err != nil {
+				return fmt.Errorf("не удалось вернуть прежнее содержимое %s: %v", objectPath, err)
+			}
+			if err := syncDir(filepath.Dir(objectPath)); err != nil {
+				return err
+			}
+			log.Printf("Восстановление: возвращено прежнее содержимое %s, загрузка не дошла до метаданных", objectPath)
+			continue
+		}
+
+		if err := os.Remove(objectPath); err == nil {
+			log.Printf("Восстановление: удалён объект %s, загрузка не дошла до метаданных", objectPath)
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("не удалось удалить %s: %v", objectPath, err)
+		}
+	}
+	return nil
+}
+
+// recoverSystemDir удаляет временные файлы служебной директории бакета и всё содержимое
+// staging: загрузка, не записанная в метаданные, клиенту не подтверждалась.
+func recoverSystemDir(systemDir string) error {
+	stagingDir := filepath.Join(systemDir, "staging")
+	err := filepath.WalkDir(systemDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == systemDir {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if filepath.Dir(path) == stagingDir || strings.HasSuffix(entry.Name(), tempFileSuffix) {
+			removeLeftover(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("не удалось проверить служебную директорию %s: %v", systemDir, err)
+	}
+	return nil
+}
+
+// recoverOrphanBucket удаляет директорию бакета, которого нет в метаданных, если в ней нет
+// ничего, кроме пустого objects.csv. Директорию с данными оставляем: её разбирает администратор.
+func recoverOrphanBucket(bucketDir string) {
+	empty := true
+	filepath.WalkDir(bucketDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if path == filepath.Join(bucketDir, "objects.csv") && !hasObjectRecords(path) {
+			return nil
+		}
+		empty = false
+		return filepath.SkipAll
+	})
+
+	if !empty {
+		log.Printf("Восстановление: директория %s не найдена в метаданных бакетов и оставлена без изменений", bucketDir)
+		return
+	}
+	if err := os.RemoveAll(bucketDir); err != nil {
+		log.Printf("Восстановление: не удалось удалить директорию %s: %v", bucketDir, err)
+		return
+	}
+	log.Printf("Восстановление: удалена директория незавершённого бакета %s", bucketDir)
+}
+
+func hasObjectRecords(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	return err != nil || len(records) > 1
+}
+
+func removeLeftover(path string) {
+	if err := os.Remove(path); err != nil {
+		log.Printf("Восстановление: не удалось удалить %s: %v", path, err)
+		return
+	}
+	log.Printf("Восстановление: удалён временный файл %s", path)
+}
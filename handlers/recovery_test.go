@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupFSRecovery подменяет хранилище данных на файловое в BaseDir,
+// чтобы RecoverDataDir видела то же, что оставил бы сбой.
+func setupFSRecovery(t *testing.T) *FSBackend {
+	t.Helper()
+	setupTestStore(t)
+	backend := NewFSBackend(BaseDir)
+	ObjectBackend = backend
+	mustCreateBucket(t, "crash-bucket")
+	return backend
+}
+
+func TestRecoverInterruptedCommit(t *testing.T) {
+	tests := []struct {
+		name         string
+		existing     bool
+		inMetadata   bool
+		wantData     string
+		wantNoObject bool
+	}{
+		{"перезапись не дошла до метаданных", true, false, "old", false},
+		{"перезапись дошла до метаданных", true, true, "new", false},
+		{"новый объект не дошёл до метаданных", false, false, "", true},
+		{"новый объект дошёл до метаданных", false, true, "new", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := setupFSRecovery(t)
+			if tt.existing {
+				mustPutObject(t, "crash-bucket", "key", "old", nil)
+			}
+
+			// Сбой между Commit и Close: журнал и резервная копия остаются в staging.
+			staged := mustStage(t, backend, "crash-bucket", "key", "new")
+			object := ObjectMetadata{Key: "key", Size: 3, LastModified: "2024-01-01T00:00:00Z", StoredETag: "22af645d1859cb5ca6da0c484f1f37ea"}
+			if err := staged.Commit(object); err != nil {
+				t.Fatalf("Commit: %v", err)
+			}
+			if tt.inMetadata {
+				if err := Store.PutObject("crash-bucket", object); err != nil {
+					t.Fatalf("PutObject: %v", err)
+				}
+			}
+
+			if err := RecoverDataDir(BaseDir); err != nil {
+				t.Fatalf("RecoverDataDir: %v", err)
+			}
+			data, ok := readBackendObject(t, backend, "crash-bucket", "key")
+			if ok == tt.wantNoObject || data != tt.wantData {
+				t.Errorf("содержимое %q (есть: %v), ожидалось %q", data, ok, tt.wantData)
+			}
+			if entries, _ := os.ReadDir(backend.stagingDir("crash-bucket")); len(entries) != 0 {
+				t.Errorf("в staging остались файлы: %v", entries)
+			}
+		})
+	}
+}
+
+func TestRecoverDataDirLeftovers(t *testing.T) {
+	setupFSRecovery(t)
+	mustPutObject(t, "crash-bucket", "key", "x", nil)
+
+	write := func(path, data string) string {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	rootTemp := write(filepath.Join(BaseDir, "buckets.csv.123"+tempFileSuffix), "partial")
+	systemTemp := write(filepath.Join(BaseDir, "crash-bucket", systemDirName, lifecycleFileName+".1"+tempFileSuffix), "partial")
+	stagingTemp := write(filepath.Join(BaseDir, "crash-bucket", systemDirName, "staging", "upload"+tempFileSuffix), "partial")
+	emptyOrphan := filepath.Join(BaseDir, "orphan-empty")
+	write(filepath.Join(emptyOrphan, "objects.csv"), "ObjectKey,Size\n")
+	dataOrphan := filepath.Join(BaseDir, "orphan-data")
+	write(filepath.Join(dataOrphan, "file"), "data")
+
+	if err := RecoverDataDir(BaseDir); err != nil {
+		t.Fatalf("RecoverDataDir: %v", err)
+	}
+	for _, path := range []string{rootTemp, systemTemp, stagingTemp, emptyOrphan} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s не удалён: %v", path, err)
+		}
+	}
+	for _, path := range []string{dataOrphan, filepath.Join(BaseDir, "buckets.csv"), filepath.Join(BaseDir, "crash-bucket", "key")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s пропал: %v", path, err)
+		}
+	}
+	if buckets, _ := Store.ListBuckets(); len(buckets) != 1 {
+		t.Errorf("бакеты после восстановления: %+v", buckets)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "buckets.csv")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := errors.New("сбой записи")
+	err := writeFileAtomic(path, dir, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("ошибка записи: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Errorf("после сбоя: %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("остались временные файлы: %v", entries)
+	}
+
+	err = writeFileAtomic(path, dir, func(w io.Writer) error {
+		_, err := w.Write([]byte("new"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("writeFileAtomic: %v", err)
+	}
+	info, _ := os.Stat(path)
+	if data, _ := os.ReadFile(path); string(data) != "new" || info.Mode().Perm() != 0o644 {
+		t.Errorf("после записи: %q, права %v", data, info.Mode().Perm())
+	}
+}
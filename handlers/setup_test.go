@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// setupTestStore подменяет глобальные хранилища на CSV-метаданные во временной
+// директории и данные в памяти. Тесты с ним не должны запускаться параллельно.
+func setupTestStore(t *testing.T) {
+	t.Helper()
+	prevBaseDir, prevStore, prevBackend := BaseDir, Store, ObjectBackend
+	prevMasterKey, prevCredentials := masterKey, credentialStore
+
+	BaseDir = t.TempDir()
+	store, err := NewCSVStore(BaseDir)
+	if err != nil {
+		t.Fatalf("NewCSVStore: %v", err)
+	}
+	Store = store
+	ObjectBackend = NewMemoryBackend()
+	masterKey = []byte("0123456789abcdef0123456789abcdef")
+	credentialStore = nil
+
+	// Close не вызывается: он навсегда захватывает общий замок метаданных.
+	t.Cleanup(func() {
+		BaseDir, Store, ObjectBackend = prevBaseDir, prevStore, prevBackend
+		masterKey, credentialStore = prevMasterKey, prevCredentials
+	})
+}
+
+// serve выполняет запрос обработчиком handler и возвращает записанный ответ.
+func serve(handler http.HandlerFunc, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func mustCreateBucket(t *testing.T, bucketName string) {
+	t.Helper()
+	if w := serve(CreateBucketHandler, "PUT", "/"+bucketName, "", nil); w.Code != http.StatusOK {
+		t.Fatalf("создание бакета %s: %d %s", bucketName, w.Code, w.Body)
+	}
+}
+
+func mustPutObject(t *testing.T, bucketName, objectName, body string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	w := serve(UploadObjectHandler, "PUT", "/"+bucketName+"/"+objectName, body, header)
+	if w.Code != http.StatusOK {
+		t.Fatalf("загрузка %s/%s: %d %s", bucketName, objectName, w.Code, w.Body)
+	}
+	return w
+}
+
+func mustSetVersioning(t *testing.T, bucketName, status string) {
+	t.Helper()
+	body := "<VersioningConfiguration><Status>" + status + "</Status></VersioningConfiguration>"
+	if w := serve(PutBucketVersioningHandler, "PUT", "/"+bucketName+"?versioning", body, nil); w.Code != http.StatusOK {
+		t.Fatalf("версионирование %s бакета %s: %d %s", status, bucketName, w.Code, w.Body)
+	}
+}
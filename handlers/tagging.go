@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxObjectTags     = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+
+	taggingDirectiveCopy    = "COPY"
+	taggingDirectiveReplace = "REPLACE"
+)
+
+type Tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	TagSet  []Tag    `xml:"TagSet>Tag"`
+}
+
+func validateTags(tags []Tag) error {
+	if len(tags) > maxObjectTags {
+		return fmt.Errorf("допускается не больше %d тегов", maxObjectTags)
+	}
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if tag.Key == "" || len(tag.Key) > maxTagKeyLength {
+			return fmt.Errorf("ключ тега должен содержать от 1 до %d символов", maxTagKeyLength)
+		}
+		if len(tag.Value) > maxTagValueLength {
+			return fmt.Errorf("значение тега %s длиннее %d символов", tag.Key, maxTagValueLength)
+		}
+		if seen[tag.Key] {
+			return fmt.Errorf("ключ тега %s повторяется", tag.Key)
+		}
+		seen[tag.Key] = true
+	}
+	return nil
+}
+
+// encodeTags записывает теги query-строкой, как в заголовке x-amz-tagging, сохраняя их порядок.
+func encodeTags(tags []Tag) string {
+	pairs := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		pairs = append(pairs, url.QueryEscape(tag.Key)+"="+url.QueryEscape(tag.Value))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// parseTags разбирает query-строку вида team=infra&retention=long.
+func parseTags(encoded string) ([]Tag, error) {
+	var tags []Tag
+	for _, pair := range strings.Split(encoded, "&") {
+		if pair == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный ключ тега %q", rawKey)
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("некорректное значение тега %q", rawValue)
+		}
+		tags = append(tags, Tag{Key: key, Value: value})
+	}
+	return tags, validateTags(tags)
+}
+
+func decodeTags(encoded string) []Tag {
+	tags, _ := parseTags(encoded)
+	return tags
+}
+
+// hasTags сообщает, есть ли у объекта все теги фильтра с теми же значениями.
+func hasTags(objectTags, filter []Tag) bool {
+	for _, want := range filter {
+		found := false
+		for _, tag := range objectTags {
+			if tag == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// requestTagging читает теги из заголовка x-amz-tagging.
+// При ошибке пишет ответ сам и возвращает false.
+func requestTagging(w http.ResponseWriter, r *http.Request) ([]Tag, bool) {
+	tags, err := parseTags(r.Header.Get("x-amz-tagging"))
+	if err != nil {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidTag", err.Error())
+		return nil, false
+	}
+	return tags, true
+}
+
+func setTaggingCountHeader(w http.ResponseWriter, tags []Tag) {
+	if len(tags) > 0 {
+		w.Header().Set("x-amz-tagging-count", strconv.Itoa(len(tags)))
+	}
+}
+
+// lookupTaggedObject находит версию объекта, с тегами которой работает запрос.
+// При ошибке пишет ответ сам и возвращает nil.
+func lookupTaggedObject(w http.ResponseWriter, r *http.Request) (string, *ObjectMetadata) {
+	bucketName, objectName, ok := parseObjectPath(r.URL.Path)
+	if !ok {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Неверный путь. Ожидалось /{bucketName}/{objectName}")
+		return "", nil
+	}
+	if isReservedObjectName(objectName) {
+		WriteS3Error(w, r, http.StatusForbidden, "AccessDenied", "Доступ к служебным файлам бакета запрещён")
+		return "", nil
+	}
+
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return "", nil
+	}
+	if !exists {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return "", nil
+	}
+
+	object, err := getRequestedObject(r, bucketName, objectName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных объектов")
+		return "", nil
+	}
+	if object == nil {
+		if _, ok := versionIDParam(r); ok {
+			WriteS3Error(w, r, http.StatusNotFound, "NoSuchVersion", "Версия объекта не найдена")
+			return "", nil
+		}
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchKey", "Объект не найден")
+		return "", nil
+	}
+	if object.DeleteMarker {
+		w.Header().Set("x-amz-delete-marker", "true")
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Версия является маркером удаления")
+		return "", nil
+	}
+	if object.VersionID != "" {
+		w.Header().Set("x-amz-version-id", object.VersionID)
+	}
+	return bucketName, object
+}
+
+// replaceObjectTags заменяет теги версии объекта из запроса.
+// Версия перезаписывается целиком, поэтому на всё время держится замок ключа.
+// При ошибке пишет ответ сам и возвращает false.
+func replaceObjectTags(w http.ResponseWriter, r *http.Request, tags []Tag) bool {
+	if bucketName, objectName, ok := parseObjectPath(r.URL.Path); ok {
+		defer lockObject(bucketName, objectName)()
+	}
+	bucketName, object := lookupTaggedObject(w, r)
+	if object == nil {
+		return false
+	}
+
+	object.Tags = tags
+	if err := Store.UpdateObject(bucketName, *object); err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка обновления метаданных объекта")
+		return false
+	}
+	return true
+}
+
+func PutObjectTaggingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	var tagging Tagging
+	if err := xml.NewDecoder(r.Body).Decode(&tagging); err != nil {
+		if writePayloadError(w, r, err) {
+			return
+		}
+		WriteS3Error(w, r, http.StatusBadRequest, "MalformedXML", "Некорректное тело запроса")
+		return
+	}
+	if err := validateTags(tagging.TagSet); err != nil {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidTag", err.Error())
+		return
+	}
+
+	if replaceObjectTags(w, r, tagging.TagSet) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func GetObjectTaggingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	_, object := lookupTaggedObject(w, r)
+	if object == nil {
+		return
+	}
+
+	writeXMLResult(w, http.StatusOK, Tagging{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/", TagSet: object.Tags})
+}
+
+func DeleteObjectTaggingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	if replaceObjectTags(w, r, nil) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func getTags(t *testing.T, target string) []Tag {
+	t.Helper()
+	w := serve(GetObjectTaggingHandler, "GET", target, "", nil)
+	var tagging Tagging
+	if w.Code != http.StatusOK || xml.Unmarshal(w.Body.Bytes(), &tagging) != nil {
+		t.Fatalf("GET %s: %d %s", target, w.Code, w.Body)
+	}
+	return tagging.TagSet
+}
+
+func TestObjectTagging(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "tags-bucket")
+	mustPutObject(t, "tags-bucket", "key", "x", http.Header{"X-Amz-Tagging": {"team=infra&note=a%20b"}})
+
+	if got, want := getTags(t, "/tags-bucket/key?tagging"), []Tag{{"team", "infra"}, {"note", "a b"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("теги из x-amz-tagging: %+v", got)
+	}
+	if w := serve(HeadObjectHandler, "HEAD", "/tags-bucket/key", "", nil); w.Header().Get("x-amz-tagging-count") != "2" {
+		t.Errorf("x-amz-tagging-count = %q", w.Header().Get("x-amz-tagging-count"))
+	}
+
+	body := "<Tagging><TagSet><Tag><Key>env</Key><Value>prod</Value></Tag></TagSet></Tagging>"
+	if w := serve(PutObjectTaggingHandler, "PUT", "/tags-bucket/key?tagging", body, nil); w.Code != http.StatusOK {
+		t.Fatalf("PUT тегов: %d %s", w.Code, w.Body)
+	}
+	if got := getTags(t, "/tags-bucket/key?tagging"); !reflect.DeepEqual(got, []Tag{{"env", "prod"}}) {
+		t.Errorf("теги после замены: %+v", got)
+	}
+	if w := serve(GetObjectHandler, "GET", "/tags-bucket/key", "", nil); w.Body.String() != "x" {
+		t.Errorf("содержимое изменилось после замены тегов: %q", w.Body)
+	}
+
+	if w := serve(DeleteObjectTaggingHandler, "DELETE", "/tags-bucket/key?tagging", "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE тегов: %d %s", w.Code, w.Body)
+	}
+	if got := getTags(t, "/tags-bucket/key?tagging"); len(got) != 0 {
+		t.Errorf("теги после удаления: %+v", got)
+	}
+	if w := serve(HeadObjectHandler, "HEAD", "/tags-bucket/key", "", nil); w.Header().Get("x-amz-tagging-count") != "" {
+		t.Errorf("x-amz-tagging-count без тегов = %q", w.Header().Get("x-amz-tagging-count"))
+	}
+}
+
+func TestObjectTaggingVersions(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "tags-bucket")
+	mustSetVersioning(t, "tags-bucket", "Enabled")
+	first := mustPutObject(t, "tags-bucket", "key", "one", http.Header{"X-Amz-Tagging": {"v=1"}}).Header().Get("x-amz-version-id")
+	mustPutObject(t, "tags-bucket", "key", "two", http.Header{"X-Amz-Tagging": {"v=2"}})
+
+	body := "<Tagging><TagSet><Tag><Key>v</Key><Value>old</Value></Tag></TagSet></Tagging>"
+	w := serve(PutObjectTaggingHandler, "PUT", "/tags-bucket/key?tagging&versionId="+first, body, nil)
+	if w.Code != http.StatusOK || w.Header().Get("x-amz-version-id") != first {
+		t.Fatalf("PUT тегов версии: %d, заголовки %v", w.Code, w.Header())
+	}
+	if got := getTags(t, "/tags-bucket/key?tagging&versionId="+first); !reflect.DeepEqual(got, []Tag{{"v", "old"}}) {
+		t.Errorf("теги прежней версии: %+v", got)
+	}
+	if got := getTags(t, "/tags-bucket/key?tagging"); !reflect.DeepEqual(got, []Tag{{"v", "2"}}) {
+		t.Errorf("теги актуальной версии: %+v", got)
+	}
+	if w := serve(GetObjectHandler, "GET", "/tags-bucket/key", "", nil); w.Body.String() != "two" {
+		t.Errorf("актуальной стала другая версия: %q", w.Body)
+	}
+}
+
+func TestObjectTaggingErrors(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "tags-bucket")
+	mustPutObject(t, "tags-bucket", "key", "x", nil)
+
+	tooMany := "<Tagging><TagSet>"
+	for i := 0; i <= maxObjectTags; i++ {
+		tooMany += "<Tag><Key>k" + strings.Repeat("x", i) + "</Key><Value>v</Value></Tag>"
+	}
+	tooMany += "</TagSet></Tagging>"
+
+	tests := []struct {
+		name     string
+		target   string
+		body     string
+		wantCode int
+		wantErr  string
+	}{
+		{"слишком много тегов", "/tags-bucket/key?tagging", tooMany, http.StatusBadRequest, "InvalidTag"},
+		{"повтор ключа", "/tags-bucket/key?tagging", "<Tagging><TagSet><Tag><Key>a</Key><Value>1</Value></Tag><Tag><Key>a</Key><Value>2</Value></Tag></TagSet></Tagging>", http.StatusBadRequest, "InvalidTag"},
+		{"пустой ключ", "/tags-bucket/key?tagging", "<Tagging><TagSet><Tag><Key></Key><Value>1</Value></Tag></TagSet></Tagging>", http.StatusBadRequest, "InvalidTag"},
+		{"некорректный XML", "/tags-bucket/key?tagging", "<Tagging>", http.StatusBadRequest, "MalformedXML"},
+		{"объекта нет", "/tags-bucket/missing?tagging", "<Tagging><TagSet></TagSet></Tagging>", http.StatusNotFound, "NoSuchKey"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(PutObjectTaggingHandler, "PUT", tt.target, tt.body, nil)
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), "<Code>"+tt.wantErr+"</Code>") {
+				t.Errorf("код %d, тело %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	w := serve(UploadObjectHandler, "PUT", "/tags-bucket/bad", "x", http.Header{"X-Amz-Tagging": {"a=1&a=2"}})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "InvalidTag") {
+		t.Errorf("x-amz-tagging с повтором ключа: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags, err := parseTags("team=infra&empty=&name=a%2Bb%26c")
+	want := []Tag{{"team", "infra"}, {"empty", ""}, {"name", "a+b&c"}}
+	if err != nil || !reflect.DeepEqual(tags, want) {
+		t.Fatalf("parseTags: %+v, %v", tags, err)
+	}
+	if got := encodeTags(tags); got != "team=infra&empty=&name=a%2Bb%26c" {
+		t.Errorf("encodeTags: %s", got)
+	}
+	if _, err := parseTags("a=%zz"); err == nil {
+		t.Error("некорректное экранирование принято")
+	}
+	if !hasTags(want, []Tag{{"team", "infra"}}) || hasTags(want, []Tag{{"team", "dev"}}) || !hasTags(nil, nil) {
+		t.Error("hasTags сравнивает теги неверно")
+	}
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	versioningEnabled   = "Enabled"
+	versioningSuspended = "Suspended"
+	nullVersionID       = "null"
+)
+
+type VersioningConfiguration struct {
+	XMLName xml.Name `xml:"VersioningConfiguration"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Status  string   `xml:"Status,omitempty"`
+}
+
+// ObjectVersion описывает элемент Version или DeleteMarker — имя берётся из XMLName.
+type ObjectVersion struct {
+	XMLName      xml.Name
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag,omitempty"`
+	Size         *int64 `xml:"Size,omitempty"`
+	StorageClass string `xml:"StorageClass,omitempty"`
+}
+
+type ListVersionsResult struct {
+	XMLName             xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListVersionsResult"`
+	Name                string   `xml:"Name"`
+	Prefix              string   `xml:"Prefix"`
+	KeyMarker           string   `xml:"KeyMarker"`
+	VersionIDMarker     string   `xml:"VersionIdMarker"`
+	NextKeyMarker       string   `xml:"NextKeyMarker,omitempty"`
+	NextVersionIDMarker string   `xml:"NextVersionIdMarker,omitempty"`
+	MaxKeys             int      `xml:"MaxKeys"`
+	Delimiter           string   `xml:"Delimiter,omitempty"`
+	EncodingType        string   `xml:"EncodingType,omitempty"`
+	IsTruncated         bool     `xml:"IsTruncated"`
+	Versions            []ObjectVersion
+	CommonPrefixes      []CommonPrefix `xml:"CommonPrefixes"`
+}
+
+func newVersionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// nextVersionID выдаёт идентификатор новой версии. Пока версионирование не включено
+// или приостановлено, пишется null-версия, которая заменяет предыдущую null-версию.
+func nextVersionID(bucket *BucketMetadata) (string, error) {
+	if bucket.Versioning != versioningEnabled {
+		return "", nil
+	}
+	return newVersionID()
+}
+
+// versionDataName возвращает ключ, под которым содержимое версии лежит в ObjectBackend.
+// null-версия хранится под ключом объекта, остальные — в служебной директории бакета.
+func versionDataName(objectName, versionID string) string {
+	if versionID == "" {
+		return objectName
+	}
+	return systemDirName + "/versions/" + versionID
+}
+
+func formatVersionID(versionID string) string {
+	if versionID == "" {
+		return nullVersionID
+	}
+	return versionID
+}
+
+// versionIDParam возвращает versionId из запроса; "null" соответствует пустому идентификатору.
+func versionIDParam(r *http.Request) (string, bool) {
+	query := r.URL.Query()
+	if !query.Has("versionId") {
+		return "", false
+	}
+	versionID := query.Get("versionId")
+	if versionID == nullVersionID {
+		versionID = ""
+	}
+	return versionID, true
+}
+
+// getRequestedObject возвращает версию из versionId либо актуальную версию объекта.
+// Маркер удаления может вернуться, только если versionId указан явно.
+func getRequestedObject(r *http.Request, bucketName, objectName string) (*ObjectMetadata, error) {
+	if versionID, ok := versionIDParam(r); ok {
+		return Store.GetObjectVersion(bucketName, objectName, versionID)
+	}
+	return Store.GetObject(bucketName, objectName)
+}
+
+// setLatestDeleteMarkerHeaders помечает ответ 404 на GET и HEAD без versionId,
+// если ключ скрыт маркером удаления, и сообщает версию маркера.
+func setLatestDeleteMarkerHeaders(w http.ResponseWriter, bucketName, objectName string) {
+	versions, err := Store.GetObjectVersions(bucketName, objectName)
+	if err != nil || len(versions) == 0 || !versions[0].DeleteMarker {
+		return
+	}
+	w.Header().Set("x-amz-delete-marker", "true")
+	w.Header().Set("x-amz-version-id", formatVersionID(versions[0].VersionID))
+}
+
+func PutBucketVersioningHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName := strings.Trim(r.URL.Path, "/")
+	bucket, err := Store.GetBucket(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if bucket == nil {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	var config VersioningConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		if writePayloadError(w, r, err) {
+			return
+		}
+		WriteS3Error(w, r, http.StatusBadRequest, "MalformedXML", "Некорректное тело запроса")
+		return
+	}
+	if config.Status != versioningEnabled && config.Status != versioningSuspended {
+		WriteS3Error(w, r, http.StatusBadRequest, "IllegalVersioningConfigurationException", "Status должен быть Enabled или Suspended")
+		return
+	}
+
+	bucket, err = Store.UpdateBucket(bucketName, func(bucket *BucketMetadata) {
+		bucket.Versioning = config.Status
+	})
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка обновления метаданных бакета")
+		return
+	}
+	if bucket == nil {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func GetBucketVersioningHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName := strings.Trim(r.URL.Path, "/")
+	bucket, err := Store.GetBucket(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if bucket == nil {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	writeXMLResult(w, http.StatusOK, VersioningConfiguration{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/", Status: bucket.Versioning})
+}
+
+func ListObjectVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+		return
+	}
+
+	bucketName := strings.Trim(r.URL.Path, "/")
+	query := r.URL.Query()
+
+	exists, err := isBucketInMetadata(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных бакетов")
+		return
+	}
+	if !exists {
+		WriteS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "Бакет не найден")
+		return
+	}
+
+	maxKeys := maxListKeys
+	if value := query.Get("max-keys"); value != "" {
+		maxKeys, err = strconv.Atoi(value)
+		if err != nil || maxKeys < 0 {
+			WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Некорректное значение max-keys")
+			return
+		}
+		if maxKeys > maxListKeys {
+			maxKeys = maxListKeys
+		}
+	}
+
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Некорректное значение encoding-type")
+		return
+	}
+
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	keyMarker := query.Get("key-marker")
+	versionIDMarker := query.Get("version-id-marker")
+	if versionIDMarker != "" && keyMarker == "" {
+		WriteS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "version-id-marker требует key-marker")
+		return
+	}
+
+	versions, err := Store.ListObjectVersions(bucketName)
+	if err != nil {
+		WriteS3Error(w, r, http.StatusInternalServerError, "InternalError", "Ошибка чтения файла метаданных объектов")
+		return
+	}
+
+	encode := func(s string) string {
+		if encodingType == "url" {
+			return url.QueryEscape(s)
+		}
+		return s
+	}
+
+	result := ListVersionsResult{
+		Name:            bucketName,
+		Prefix:          encode(prefix),
+		KeyMarker:       encode(keyMarker),
+		VersionIDMarker: versionIDMarker,
+		MaxKeys:         maxKeys,
+		Delimiter:       encode(delimiter),
+		EncodingType:    encodingType,
+	}
+
+	// Страница, закончившаяся версией, всегда отдаёт NextVersionIdMarker, поэтому key-marker
+	// без version-id-marker, совпадающий с общим префиксом, пришёл из CommonPrefixes.
+	markerIsPrefix := versionIDMarker == "" && keyMarker != "" && rolledUpPrefix(keyMarker, prefix, delimiter) == keyMarker
+	count := 0
+	lastKey, lastVersionID, lastPrefix := "", "", ""
+	// Версии ключа key-marker пропускаются до version-id-marker включительно, а без него — все.
+	pastVersionMarker := false
+	for i, version := range versions {
+		if !strings.HasPrefix(version.Key, prefix) || version.Key < keyMarker {
+			continue
+		}
+		if version.Key == keyMarker && !pastVersionMarker {
+			pastVersionMarker = formatVersionID(version.VersionID) == versionIDMarker
+			continue
+		}
+		if markerIsPrefix && strings.HasPrefix(version.Key, keyMarker) {
+			continue
+		}
+
+		commonPrefix := rolledUpPrefix(version.Key, prefix, delimiter)
+		if commonPrefix != "" && commonPrefix == lastPrefix {
+			continue
+		}
+
+		if count == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		count++
+
+		if commonPrefix != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, CommonPrefix{Prefix: encode(commonPrefix)})
+			lastPrefix = commonPrefix
+			lastKey, lastVersionID = commonPrefix, ""
+			continue
+		}
+
+		entry := ObjectVersion{
+			XMLName:      xml.Name{Space: "http://s3.amazonaws.com/doc/2006-03-01/", Local: "Version"},
+			Key:          encode(version.Key),
+			VersionID:    formatVersionID(version.VersionID),
+			IsLatest:     i == 0 || versions[i-1].Key != version.Key,
+			LastModified: formatS3Time(version.LastModified),
+		}
+		if version.DeleteMarker {
+			entry.XMLName.Local = "DeleteMarker"
+		} else {
+			size := version.Size
+			entry.ETag = version.ETag()
+			entry.Size = &size
+			entry.StorageClass = "STANDARD"
+		}
+		result.Versions = append(result.Versions, entry)
+		lastKey, lastVersionID = version.Key, entry.VersionID
+	}
+
+	if result.IsTruncated {
+		result.NextKeyMarker = encode(lastKey)
+		result.NextVersionIDMarker = lastVersionID
+	}
+
+	writeXMLResult(w, http.StatusOK, result)
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+// versionsPage — ответ ListObjectVersions, в котором версии и маркеры удаления идут вперемешку.
+type versionsPage struct {
+	IsTruncated         bool
+	NextKeyMarker       string
+	NextVersionIDMarker string
+	CommonPrefixes      []CommonPrefix
+	Entries             []ObjectVersion
+}
+
+func (p *versionsPage) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "Version", "DeleteMarker":
+				var entry ObjectVersion
+				if err := d.DecodeElement(&entry, &element); err != nil {
+					return err
+				}
+				p.Entries = append(p.Entries, entry)
+			case "CommonPrefixes":
+				var prefix CommonPrefix
+				if err := d.DecodeElement(&prefix, &element); err != nil {
+					return err
+				}
+				p.CommonPrefixes = append(p.CommonPrefixes, prefix)
+			case "IsTruncated":
+				if err := d.DecodeElement(&p.IsTruncated, &element); err != nil {
+					return err
+				}
+			case "NextKeyMarker":
+				if err := d.DecodeElement(&p.NextKeyMarker, &element); err != nil {
+					return err
+				}
+			case "NextVersionIdMarker":
+				if err := d.DecodeElement(&p.NextVersionIDMarker, &element); err != nil {
+					return err
+				}
+			default:
+				if err := d.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// listAllVersionPages проходит ListObjectVersions по NextKeyMarker и NextVersionIdMarker.
+// Маркеры удаления помечаются "marker:", общие префиксы — "prefix:".
+func listAllVersionPages(t *testing.T, bucketName string, query url.Values) []string {
+	t.Helper()
+	var entries []string
+	for page := 0; page < 100; page++ {
+		w := serve(ListObjectVersionsHandler, "GET", "/"+bucketName+"?versions&"+query.Encode(), "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("ListObjectVersions %s: %d %s", query.Encode(), w.Code, w.Body)
+		}
+		var result versionsPage
+		if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("разбор ответа: %v", err)
+		}
+		for _, entry := range result.Entries {
+			if entry.XMLName.Local == "DeleteMarker" {
+				entries = append(entries, "marker:"+entry.Key)
+			} else {
+				entries = append(entries, entry.Key)
+			}
+		}
+		for _, prefix := range result.CommonPrefixes {
+			entries = append(entries, "prefix:"+prefix.Prefix)
+		}
+		if !result.IsTruncated {
+			return entries
+		}
+		query.Set("key-marker", result.NextKeyMarker)
+		if result.NextVersionIDMarker != "" {
+			query.Set("version-id-marker", result.NextVersionIDMarker)
+		} else {
+			query.Del("version-id-marker")
+		}
+	}
+	t.Fatalf("ListObjectVersions не закончился за 100 страниц: %s", query.Encode())
+	return nil
+}
+
+func TestListObjectVersionsPaging(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "versions-bucket")
+	mustSetVersioning(t, "versions-bucket", "Enabled")
+	for _, key := range []string{"a", "photos/", "photos/1", "photos/1", "photos/sub/2", "z"} {
+		mustPutObject(t, "versions-bucket", key, "x", nil)
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  []string
+	}{
+		{
+			name:  "все версии по одной",
+			query: url.Values{"max-keys": {"1"}},
+			want:  []string{"a", "photos/", "photos/1", "photos/1", "photos/sub/2", "z"},
+		},
+		{
+			name:  "общий префикс не повторяется на следующей странице",
+			query: url.Values{"delimiter": {"/"}, "max-keys": {"1"}},
+			want:  []string{"a", "prefix:photos/", "z"},
+		},
+		{
+			name:  "ключ-папка в конце страницы не скрывает вложенные ключи",
+			query: url.Values{"prefix": {"photos/"}, "delimiter": {"/"}, "max-keys": {"1"}},
+			want:  []string{"photos/", "photos/1", "photos/1", "prefix:photos/sub/"},
+		},
+		{
+			name:  "key-marker без разделителя сравнивается как ключ",
+			query: url.Values{"key-marker": {"photos/"}},
+			want:  []string{"photos/1", "photos/1", "photos/sub/2", "z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listAllVersionPages(t, "versions-bucket", tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("получено %q, ожидалось %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteObjectVersions(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "versions-bucket")
+	mustSetVersioning(t, "versions-bucket", "Enabled")
+	first := mustPutObject(t, "versions-bucket", "key", "one", nil).Header().Get("x-amz-version-id")
+	second := mustPutObject(t, "versions-bucket", "key", "two", nil).Header().Get("x-amz-version-id")
+
+	w := serve(DeleteObjectHandler, "DELETE", "/versions-bucket/key", "", nil)
+	marker := w.Header().Get("x-amz-version-id")
+	if w.Code != http.StatusNoContent || w.Header().Get("x-amz-delete-marker") != "true" || marker == "" {
+		t.Fatalf("удаление без versionId: %d, заголовки %v", w.Code, w.Header())
+	}
+
+	steps := []struct {
+		name     string
+		method   string
+		target   string
+		wantCode int
+		wantBody string
+	}{
+		{"маркер скрывает объект", "GET", "/versions-bucket/key", http.StatusNotFound, ""},
+		{"прежняя версия доступна", "GET", "/versions-bucket/key?versionId=" + first, http.StatusOK, "one"},
+		{"удаление маркера", "DELETE", "/versions-bucket/key?versionId=" + marker, http.StatusNoContent, ""},
+		{"объект снова виден", "GET", "/versions-bucket/key", http.StatusOK, "two"},
+		{"удаление последней версии", "DELETE", "/versions-bucket/key?versionId=" + second, http.StatusNoContent, ""},
+		{"актуальной стала предыдущая", "GET", "/versions-bucket/key", http.StatusOK, "one"},
+		{"удалённой версии нет", "GET", "/versions-bucket/key?versionId=" + second, http.StatusNotFound, ""},
+		{"повторное удаление версии", "DELETE", "/versions-bucket/key?versionId=" + second, http.StatusNotFound, ""},
+	}
+	for _, step := range steps {
+		handler := GetObjectHandler
+		if step.method == "DELETE" {
+			handler = DeleteObjectHandler
+		}
+		w := serve(handler, step.method, step.target, "", nil)
+		if w.Code != step.wantCode || (step.wantBody != "" && w.Body.String() != step.wantBody) {
+			t.Fatalf("%s: код %d, тело %q", step.name, w.Code, w.Body)
+		}
+	}
+
+	if _, err := ObjectBackend.Stat("versions-bucket", versionDataName("key", second)); err == nil {
+		t.Error("содержимое удалённой версии осталось в хранилище")
+	}
+	if _, err := ObjectBackend.Stat("versions-bucket", versionDataName("key", first)); err != nil {
+		t.Errorf("содержимое оставшейся версии пропало: %v", err)
+	}
+}
+
+func TestGetObjectBehindDeleteMarker(t *testing.T) {
+	setupTestStore(t)
+	mustCreateBucket(t, "versions-bucket")
+	mustSetVersioning(t, "versions-bucket", "Enabled")
+	mustPutObject(t, "versions-bucket", "key", "one", nil)
+	marker := serve(DeleteObjectHandler, "DELETE", "/versions-bucket/key", "", nil).Header().Get("x-amz-version-id")
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		method   string
+		target   string
+		wantCode int
+	}{
+		{"GET актуальной версии", GetObjectHandler, "GET", "/versions-bucket/key", http.StatusNotFound},
+		{"HEAD актуальной версии", HeadObjectHandler, "HEAD", "/versions-bucket/key", http.StatusNotFound},
+		{"GET маркера по versionId", GetObjectHandler, "GET", "/versions-bucket/key?versionId=" + marker, http.StatusMethodNotAllowed},
+		{"HEAD маркера по versionId", HeadObjectHandler, "HEAD", "/versions-bucket/key?versionId=" + marker, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.handler, tt.method, tt.target, "", nil)
+			if w.Code != tt.wantCode || w.Header().Get("x-amz-delete-marker") != "true" || w.Header().Get("x-amz-version-id") != marker {
+				t.Errorf("код %d, заголовки %v", w.Code, w.Header())
+			}
+		})
+	}
+
+	version := mustPutObject(t, "versions-bucket", "other", "x", nil).Header().Get("x-amz-version-id")
+	serve(DeleteObjectHandler, "DELETE", "/versions-bucket/other?versionId="+version, "", nil)
+	if w := serve(GetObjectHandler, "GET", "/versions-bucket/other", "", nil); w.Code != http.StatusNotFound || w.Header().Get("x-amz-delete-marker") != "" {
+		t.Errorf("ключ без маркера: код %d, заголовки %v", w.Code, w.Header())
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 	"triple-s/handlers"
 )
 
@@ -17,9 +22,146 @@ func ensureDir(dir string) {
 	}
 }
 
+// resolveMetadataStore возвращает хранилище метаданных, которым записана директория dir.
+// Явно указанное хранилище должно с ним совпадать, иначе процесс завершается. allowImport
+// разрешает переход с csv на log: LogStore при первом запуске сам импортирует CSV.
+func resolveMetadataStore(dir, requested string, allowImport bool) string {
+	detected := handlers.DetectMetadataStore(dir)
+	switch {
+	case requested == "" || requested == detected:
+		return detected
+	case allowImport && detected == "csv" && requested == "log":
+		return requested
+	}
+	log.Fatalf("Директория данных записана хранилищем метаданных %s, а указано --metadata %s", detected, requested)
+	return ""
+}
+
+func runPresign(args []string) {
+	fs := flag.NewFlagSet("presign", flag.ExitOnError)
+	credentials := fs.String("credentials", "", "CSV file with AccessKey,SecretKey pairs")
+	accessKey := fs.String("access-key", "", "Access key to sign with (defaults to the first key in the file)")
+	endpoint := fs.String("endpoint", "http://localhost:8080", "Base URL of the server")
+	method := fs.String("method", "GET", "HTTP method the URL is valid for (GET or PUT)")
+	bucket := fs.String("bucket", "", "Bucket name")
+	key := fs.String("key", "", "Object key")
+	expires := fs.Duration("expires", time.Hour, "How long the URL stays valid (max 168h)")
+	fs.Parse(args)
+
+	if *credentials == "" || *bucket == "" || *key == "" {
+		fmt.Fprintln(os.Stderr, "Использование: triple-s presign --credentials FILE --bucket NAME --key KEY [--method GET|PUT] [--expires 1h] [--endpoint URL]")
+		os.Exit(2)
+	}
+
+	if err := handlers.LoadCredentials(*credentials); err != nil {
+		log.Fatalf("Ошибка загрузки ключей доступа: %v", err)
+	}
+
+	url, err := handlers.PresignURL(*endpoint, strings.ToUpper(*method), *bucket, *key, *accessKey, *expires)
+	if err != nil {
+		log.Fatalf("Не удалось сформировать ссылку: %v", err)
+	}
+	fmt.Println(url)
+}
+
+func runFsck(args []string) {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	dir := fs.String("dir", "data", "Directory for storing buckets")
+	metadataStore := fs.String("metadata", "", "Metadata store: csv or log (detected from the directory by default)")
+	repair := fs.Bool("repair", false, "Rebuild metadata from the files on disk where possible")
+	fs.Parse(args)
+
+	if !handlers.IsValidDir(*dir) {
+		log.Fatalf("Недопустимое имя директории: %s", *dir)
+	}
+	if _, err := os.Stat(*dir); err != nil {
+		log.Fatalf("Директория данных недоступна: %v", err)
+	}
+	handlers.BaseDir = *dir
+
+	// Проверять и тем более исправлять можно только по хранилищу, в которое пишет сервер:
+	// остальные файлы метаданных устарели, и восстановление по ним теряет данные.
+	store, err := handlers.NewMetadataStore(resolveMetadataStore(*dir, *metadataStore, false), *dir)
+	if err != nil {
+		log.Fatalf("Ошибка инициализации хранилища метаданных: %v", err)
+	}
+	handlers.Store = store
+	handlers.ObjectBackend = handlers.NewFSBackend(*dir)
+
+	report, err := handlers.Fsck(*dir, *repair, os.Stdout)
+	if closeErr := store.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Fatalf("Проверка прервана: %v", err)
+	}
+
+	fmt.Printf("Найдено проблем: %d, исправлено: %d\n", report.Problems, report.Repaired)
+	if report.Problems > report.Repaired {
+		os.Exit(1)
+	}
+}
+
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dir := fs.String("dir", "data", "Directory for storing buckets")
+	dryRun := fs.Bool("dry-run", false, "Only describe what the migrations would change")
+	fs.Parse(args)
+
+	if !handlers.IsValidDir(*dir) {
+		log.Fatalf("Недопустимое имя директории: %s", *dir)
+	}
+	if _, err := os.Stat(*dir); err != nil {
+		log.Fatalf("Директория данных недоступна: %v", err)
+	}
+
+	status, err := handlers.ReadSchemaVersion(*dir)
+	if err != nil {
+		log.Fatalf("Ошибка чтения схемы данных: %v", err)
+	}
+	fmt.Printf("Схема данных: версия %d, текущая %d\n", status.Version, handlers.CurrentSchemaVersion)
+
+	applied, err := handlers.MigrateDataDir(*dir, *dryRun, log.New(os.Stdout, "", 0))
+	if err != nil {
+		log.Fatalf("Ошибка миграции данных: %v", err)
+	}
+	if *dryRun {
+		fmt.Printf("Будет применено миграций: %d\n", applied)
+	} else {
+		fmt.Printf("Применено миграций: %d\n", applied)
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "presign":
+			runPresign(os.Args[2:])
+			return
+		case "fsck":
+			runFsck(os.Args[2:])
+			return
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		}
+	}
+
 	port := flag.Int("port", 8080, "Port number for server")
 	dir := flag.String("dir", "data", "Directory for storing buckets")
+	credentials := flag.String("credentials", "", "CSV file with AccessKey,SecretKey pairs for SigV4 authentication")
+	metadataStore := flag.String("metadata", "", "Metadata store: csv (buckets.csv/objects.csv) or log (indexed append-only metadata.log); detected from the directory by default")
+	backend := flag.String("backend", "fs", "Object data backend: fs (files under --dir) or memory (kept in process memory, lost on restart)")
+	masterKey := flag.String("master-key", "", "File with a base64 256-bit master key for SSE-S3 (x-amz-server-side-encryption: AES256)")
+	lifecycleInterval := flag.Duration("lifecycle-interval", time.Hour, "How often lifecycle rules are applied; 0 disables the worker")
+	domain := flag.String("domain", "", "Base domain for virtual-hosted-style requests ({bucket}.domain); path style always works")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 10*time.Second, "Maximum time to read request headers")
+	readTimeout := flag.Duration("read-timeout", 0, "Maximum time to read a whole request including the body; 0 means no limit")
+	writeTimeout := flag.Duration("write-timeout", 0, "Maximum time to write a response; 0 means no limit")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "How long an idle keep-alive connection is kept open")
+	maxHeaderBytes := flag.Int("max-header-bytes", http.DefaultMaxHeaderBytes, "Maximum size of request headers in bytes")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "How long to wait for in-flight requests on SIGINT/SIGTERM")
+	autoMigrate := flag.Bool("auto-migrate", true, "Upgrade the data directory schema on startup; when false, refuse to start on an outdated schema")
 	flag.Parse()
 
 	if !handlers.IsValidDir(*dir) {
@@ -28,47 +170,205 @@ func main() {
 
 	ensureDir(*dir)
 	handlers.BaseDir = *dir
+	handlers.BaseDomain = strings.ToLower(strings.Trim(*domain, "."))
+
+	if *autoMigrate {
+		if _, err := handlers.MigrateDataDir(*dir, false, log.Default()); err != nil {
+			log.Fatalf("Ошибка миграции данных: %v", err)
+		}
+	} else if status, err := handlers.ReadSchemaVersion(*dir); err != nil {
+		log.Fatalf("Ошибка чтения схемы данных: %v", err)
+	} else if status.Pending > 0 {
+		log.Fatalf("Схема данных устарела (версия %d, текущая %d), выполните: triple-s migrate --dir %s", status.Version, handlers.CurrentSchemaVersion, *dir)
+	}
 
-	if err := handlers.InitializeMetadataFile(*dir); err != nil {
-		log.Fatalf("Ошибка инициализации файла метаданных: %v", err)
+	store, err := handlers.NewMetadataStore(resolveMetadataStore(*dir, *metadataStore, true), *dir)
+	if err != nil {
+		log.Fatalf("Ошибка инициализации хранилища метаданных: %v", err)
+	}
+	handlers.Store = store
+
+	objectBackend, err := handlers.NewBackend(*backend, *dir)
+	if err != nil {
+		log.Fatalf("Ошибка инициализации хранилища данных: %v", err)
+	}
+	handlers.ObjectBackend = objectBackend
+
+	if err := handlers.RecoverDataDir(*dir); err != nil {
+		log.Fatalf("Ошибка восстановления после сбоя: %v", err)
+	}
+
+	if *credentials != "" {
+		if err := handlers.LoadCredentials(*credentials); err != nil {
+			log.Fatalf("Ошибка загрузки ключей доступа: %v", err)
+		}
+	} else {
+		log.Println("Файл ключей доступа не указан, аутентификация запросов отключена")
+	}
+
+	if *masterKey != "" {
+		if err := handlers.LoadMasterKey(*masterKey); err != nil {
+			log.Fatalf("Ошибка загрузки мастер-ключа: %v", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var lifecycleDone <-chan struct{}
+	if *lifecycleInterval > 0 {
+		lifecycleDone = handlers.StartLifecycleWorker(ctx, *lifecycleInterval)
+	} else {
+		done := make(chan struct{})
+		close(done)
+		lifecycleDone = done
 	}
 
 	address := fmt.Sprintf(":%d", *port)
 	fmt.Printf("Сервер запущен на %s\n", address)
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.SetRequestID(w)
+		if !handlers.Authenticate(w, r) {
+			return
+		}
+		handlers.RewriteVirtualHost(r)
+
 		pathSegments := handlers.ParseURLPath(r.URL.Path)
+		query := r.URL.Query()
 		if len(pathSegments) == 0 {
 			switch r.Method {
 			case "GET":
 				handlers.ListBucketsHandler(w, r)
 			default:
-				handlers.WriteXMLResponse(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+				handlers.WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
 			}
 		} else if len(pathSegments) == 1 {
 			switch r.Method {
+			case "GET":
+				if query.Has("uploads") {
+					handlers.ListMultipartUploadsHandler(w, r)
+				} else if query.Has("versioning") {
+					handlers.GetBucketVersioningHandler(w, r)
+				} else if query.Has("lifecycle") {
+					handlers.GetBucketLifecycleHandler(w, r)
+				} else if query.Has("versions") {
+					handlers.ListObjectVersionsHandler(w, r)
+				} else {
+					handlers.ListObjectsHandler(w, r)
+				}
+			case "HEAD":
+				handlers.HeadBucketHandler(w, r)
 			case "PUT":
-				handlers.CreateBucketHandler(w, r)
+				if query.Has("versioning") {
+					handlers.PutBucketVersioningHandler(w, r)
+				} else if query.Has("lifecycle") {
+					handlers.PutBucketLifecycleHandler(w, r)
+				} else {
+					handlers.CreateBucketHandler(w, r)
+				}
+			case "POST":
+				if query.Has("delete") {
+					handlers.DeleteObjectsHandler(w, r)
+				} else {
+					handlers.WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+				}
 			case "DELETE":
-				handlers.DeleteBucketHandler(w, r)
+				if query.Has("lifecycle") {
+					handlers.DeleteBucketLifecycleHandler(w, r)
+				} else {
+					handlers.DeleteBucketHandler(w, r)
+				}
 			default:
-				handlers.WriteXMLResponse(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+				handlers.WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
 			}
 		} else if len(pathSegments) >= 2 {
 			switch r.Method {
 			case "PUT":
-				handlers.UploadObjectHandler(w, r)
+				copySource := r.Header.Get("x-amz-copy-source") != ""
+				if query.Has("tagging") {
+					handlers.PutObjectTaggingHandler(w, r)
+				} else if query.Has("uploadId") && copySource {
+					handlers.UploadPartCopyHandler(w, r)
+				} else if query.Has("uploadId") {
+					handlers.UploadPartHandler(w, r)
+				} else if copySource {
+					handlers.CopyObjectHandler(w, r)
+				} else {
+					handlers.UploadObjectHandler(w, r)
+				}
+			case "POST":
+				if query.Has("uploads") {
+					handlers.CreateMultipartUploadHandler(w, r)
+				} else if query.Has("uploadId") {
+					handlers.CompleteMultipartUploadHandler(w, r)
+				} else {
+					handlers.WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+				}
 			case "DELETE":
-				handlers.DeleteObjectHandler(w, r)
+				if query.Has("tagging") {
+					handlers.DeleteObjectTaggingHandler(w, r)
+				} else if query.Has("uploadId") {
+					handlers.AbortMultipartUploadHandler(w, r)
+				} else {
+					handlers.DeleteObjectHandler(w, r)
+				}
 			case "GET":
-				handlers.GetObjectHandler(w, r)
+				if query.Has("tagging") {
+					handlers.GetObjectTaggingHandler(w, r)
+				} else if query.Has("uploadId") {
+					handlers.ListPartsHandler(w, r)
+				} else {
+					handlers.GetObjectHandler(w, r)
+				}
+			case "HEAD":
+				handlers.HeadObjectHandler(w, r)
 			default:
-				handlers.WriteXMLResponse(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
+				handlers.WriteS3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "Метод не поддерживается")
 			}
 		} else {
-			handlers.WriteXMLResponse(w, http.StatusBadRequest, "InvalidPath", "Неверный путь")
+			handlers.WriteS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "Неверный путь")
 		}
 	})
 
-	log.Fatal(http.ListenAndServe(address, nil))
+	server := &http.Server{
+		Addr:              address,
+		ReadHeaderTimeout: *readHeaderTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+		MaxHeaderBytes:    *maxHeaderBytes,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		log.Fatalf("Ошибка сервера: %v", err)
+	case <-ctx.Done():
+	}
+	// Повторный сигнал завершает процесс сразу, не дожидаясь запросов.
+	stop()
+
+	log.Printf("Получен сигнал остановки, ожидаем завершения запросов (до %s)", *shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Не все запросы завершились вовремя, соединения закрыты принудительно: %v", err)
+		server.Close()
+	}
+	select {
+	case <-lifecycleDone:
+	case <-shutdownCtx.Done():
+		log.Println("Проход жизненного цикла не завершился вовремя")
+	}
+
+	if err := handlers.Store.Close(); err != nil {
+		log.Printf("Ошибка сохранения метаданных: %v", err)
+	}
+	log.Println("Сервер остановлен")
 }